@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/subutux/hass_companion/hass/mobile_app"
+	"github.com/subutux/hass_companion/hass/mobile_app/sensors"
+	"github.com/subutux/hass_companion/hass/ws"
+)
+
+// RegisterCommands registers the handlers of the notification commands Home
+// Assistant can send to the companion.
+func RegisterCommands(mobile *mobile_app.MobileApp, systemBus, sessionBus *dbus.Conn) {
+	// Media commands follow the Android companion app:
+	//
+	//	message: command_media
+	//	data:
+	//	  media_command: pause
+	//	  media_package_name: spotify
+	mobile.HandleCommand("command_media", func(notification *ws.IncomingPushNotificationMessage) error {
+		if sessionBus == nil {
+			return errors.New("no session bus available")
+		}
+		data := notification.Event.Data
+		return sensors.ControlMedia(sessionBus, data.MediaPackageName, data.MediaCommand, string(data.Command))
+	})
+
+	// Profiles are the ones power-profiles-daemon offers, usually
+	// power-saver, balanced and performance:
+	//
+	//	message: command_power_profile
+	//	data:
+	//	  command: power-saver
+	mobile.HandleCommand("command_power_profile", func(notification *ws.IncomingPushNotificationMessage) error {
+		if systemBus == nil {
+			return errors.New("no system bus available")
+		}
+		return sensors.SetPowerProfile(systemBus, string(notification.Event.Data.Command))
+	})
+
+	// Brightness of the display backlight in percent:
+	//
+	//	message: command_brightness
+	//	data:
+	//	  command: 40
+	mobile.HandleCommand("command_brightness", func(notification *ws.IncomingPushNotificationMessage) error {
+		if systemBus == nil {
+			return errors.New("no system bus available")
+		}
+		value := string(notification.Event.Data.Command)
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid brightness %q", value)
+		}
+		return sensors.SetBrightness(systemBus, percent)
+	})
+
+	// Containers of Docker or Podman, by name or ID:
+	//
+	//	message: command_container_start
+	//	data:
+	//	  command: postgres
+	for _, action := range []string{"start", "stop", "restart"} {
+		action := action
+		mobile.HandleCommand("command_container_"+action, func(notification *ws.IncomingPushNotificationMessage) error {
+			return sensors.ControlContainer(string(notification.Event.Data.Command), action)
+		})
+	}
+}
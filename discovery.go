@@ -0,0 +1,253 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/subutux/hass_companion/hass/mobile_app/sensors"
+	"github.com/subutux/hass_companion/internal/config"
+	"github.com/subutux/hass_companion/internal/logger"
+)
+
+// discoveryDebounce is the time to wait for more device events before
+// discovering sensors again, as plugging in a device often sends several.
+const discoveryDebounce = 2 * time.Second
+
+// DeviceSignal is a D-Bus signal on the system bus that announces a device
+// coming or going.
+type DeviceSignal struct {
+	// Name is the signal, as interface.member
+	Name string
+	// Path is the namespace of the objects the signal is about. For
+	// ObjectManager signals it is matched against the object added or
+	// removed, as they are sent from the root object.
+	Path string
+}
+
+func (d DeviceSignal) matches(v *dbus.Signal) bool {
+	if v.Name != d.Name {
+		return false
+	}
+	path := v.Path
+	if strings.HasPrefix(d.Name, "org.freedesktop.DBus.ObjectManager.") {
+		if len(v.Body) < 1 {
+			return false
+		}
+		path, _ = v.Body[0].(dbus.ObjectPath)
+	}
+	return path == dbus.ObjectPath(d.Path) || strings.HasPrefix(string(path), d.Path+"/")
+}
+
+// sensorKey identifies a sensor across discoveries by its unique IDs in the
+// namespace, whether it was adopted already or not.
+func sensorKey(namespace string, sensor sensors.SensorInterface) string {
+	ids := []string{}
+	for _, sen := range sensor.GetSensors() {
+		ids = append(ids, sensors.UniqueID(namespace, sen.UniqueID))
+	}
+	return strings.Join(ids, ",")
+}
+
+// Rediscover runs the discovery of the named built-in sensors again. Sensors
+// that appeared are added, sensors that are gone are reported unavailable
+// and removed. Sensors that are still there are kept as they are, and so
+// are all of them when the discovery fails.
+func (s *SensorSet) Rediscover(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, builtin := range s.builtin {
+		if !contains(names, builtin.Name) || !config.Sensor(builtin.Name).IsEnabled() {
+			continue
+		}
+		s.rediscover(builtin)
+	}
+}
+
+// rediscover runs the discovery of the built-in sensor again and replaces
+// its active sensors with the ones found. When the discovery fails, the
+// active sensors are kept, as the failure may well be temporary.
+func (s *SensorSet) rediscover(builtin BuiltinSensor) {
+	patterns := patternsOf(config.Sensor(builtin.Name))
+	found, err := builtin.Discover()
+	if err != nil {
+		logger.I().Warn("Failed to discover sensor again", "sensor", builtin.Name, "error", err)
+		return
+	}
+	s.replace(builtin, found)
+	s.patterns[builtin.Name] = patterns
+}
+
+// replace swaps the active sensors of the built-in sensor for the ones
+// found, keeping the active sensors that were found again.
+func (s *SensorSet) replace(builtin BuiltinSensor, found []sensors.SensorInterface) {
+	name, namespace := builtin.Name, builtin.namespace()
+	previous := map[string]sensors.SensorInterface{}
+	for _, sensor := range s.active[name] {
+		previous[sensorKey(namespace, sensor)] = sensor
+	}
+
+	active := []sensors.SensorInterface{}
+	seen := map[string]bool{}
+	for _, sensor := range found {
+		key := sensorKey(namespace, sensor)
+		seen[key] = true
+		if existing, ok := previous[key]; ok {
+			active = append(active, existing)
+			continue
+		}
+		logger.I().Info("Discovered sensor", "sensor", name, "id", key)
+		s.adopt(namespace, sensor)
+		s.configure(name, sensor)
+		s.collector.AddSensor(sensor)
+		s.content.AppendSensor(sensor)
+		active = append(active, sensor)
+	}
+
+	for key, sensor := range previous {
+		if seen[key] {
+			continue
+		}
+		logger.I().Info("Sensor went away", "sensor", name, "id", key)
+		s.collector.RetireSensor(sensor)
+		s.content.RemoveSensor(sensor)
+		delete(s.intervals, sensor)
+	}
+
+	if len(active) == 0 {
+		delete(s.active, name)
+		return
+	}
+	s.active[name] = active
+}
+
+// WatchDevices discovers the hotplug sensors again when devices come or go,
+// and on the given interval to catch what isn't announced, like a disk being
+// mounted. It blocks until stop is closed.
+func (s *SensorSet) WatchDevices(systemBus *dbus.Conn, interval time.Duration, stop <-chan struct{}) {
+	events := make(chan string, 16)
+	queue := func(names []string) {
+		for _, name := range names {
+			select {
+			case events <- name:
+			case <-stop:
+			}
+		}
+	}
+
+	subsystems := map[string][]string{}
+	signals := []DeviceSignal{}
+	hotplug := []string{}
+	for _, builtin := range s.builtin {
+		if !builtin.Hotplug {
+			continue
+		}
+		hotplug = append(hotplug, builtin.Name)
+		for _, subsystem := range builtin.Subsystems {
+			subsystems[subsystem] = append(subsystems[subsystem], builtin.Name)
+		}
+		signals = append(signals, builtin.Signals...)
+	}
+
+	go func() {
+		err := sensors.WatchDevices(func(action, subsystem string) {
+			queue(subsystems[subsystem])
+		}, stop)
+		if err != nil {
+			logger.I().Warn("Unable to watch for device changes", "error", err)
+		}
+	}()
+	if systemBus != nil && len(signals) > 0 {
+		go s.watchDeviceSignals(systemBus, signals, queue, stop)
+	}
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	pending := map[string]bool{}
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick:
+			s.Rediscover(hotplug...)
+		case name := <-events:
+			pending[name] = true
+			if debounce == nil {
+				debounce = time.After(discoveryDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			names := []string{}
+			for name := range pending {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			pending = map[string]bool{}
+			s.Rediscover(names...)
+		}
+	}
+}
+
+// watchDeviceSignals queues the built-in sensors of the D-Bus signals that
+// announce a device coming or going.
+func (s *SensorSet) watchDeviceSignals(conn *dbus.Conn, signals []DeviceSignal, queue func([]string), stop <-chan struct{}) {
+	added := map[string]bool{}
+	for _, signal := range signals {
+		if added[signal.Name] {
+			continue
+		}
+		added[signal.Name] = true
+		i := strings.LastIndex(signal.Name, ".")
+		options := []dbus.MatchOption{
+			dbus.WithMatchInterface(signal.Name[:i]),
+			dbus.WithMatchMember(signal.Name[i+1:]),
+		}
+		err := conn.AddMatchSignal(options...)
+		if err != nil {
+			logger.I().Warn("Unable to watch for device signals", "signal", signal.Name, "error", err)
+			continue
+		}
+		defer conn.RemoveMatchSignal(options...)
+	}
+
+	c := make(chan *dbus.Signal, 10)
+	conn.Signal(c)
+	defer conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case v, ok := <-c:
+			if !ok {
+				return
+			}
+			for _, builtin := range s.builtin {
+				for _, signal := range builtin.Signals {
+					if builtin.Hotplug && signal.matches(v) {
+						queue([]string{builtin.Name})
+					}
+				}
+			}
+		}
+	}
+}
+
+// contains reports whether list holds value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package mobile_app
 import (
 	"fmt"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/subutux/hass_companion/hass/auth"
@@ -16,6 +17,9 @@ type MobileApp struct {
 	Registration    *rest.RegistrationResponse
 	ws              *ws.Client
 	SensorCollector *sensors.Collector
+
+	mu       sync.Mutex
+	commands map[string]CommandHandler
 }
 
 func NewMobileApp(registration *rest.RegistrationResponse, creds *auth.Credentials, ws *ws.Client, interval time.Duration) *MobileApp {
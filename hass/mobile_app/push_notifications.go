@@ -1,6 +1,8 @@
 package mobile_app
 
 import (
+	"strings"
+
 	"github.com/godbus/dbus/v5"
 	"github.com/subutux/hass_companion/hass/ws"
 	"github.com/subutux/hass_companion/internal/logger"
@@ -21,6 +23,48 @@ func (m *MobileApp) WatchForPushNotifications(callback func(notification *ws.Inc
 	}
 }
 
+// CommandHandler carries out a notification command, like command_media.
+type CommandHandler func(notification *ws.IncomingPushNotificationMessage) error
+
+// HandleCommand registers the handler of a notification command. Home
+// Assistant sends commands as notifications with the command as message.
+func (m *MobileApp) HandleCommand(command string, handler CommandHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.commands == nil {
+		m.commands = map[string]CommandHandler{}
+	}
+	m.commands[command] = handler
+}
+
+// HandlePushNotification carries out notification commands with their
+// registered handler and shows all other notifications on the desktop.
+func (m *MobileApp) HandlePushNotification(notification *ws.IncomingPushNotificationMessage) {
+	message := notification.Event.Message
+	if !strings.HasPrefix(message, "command_") {
+		m.FreedesktopNotifier(notification)
+		return
+	}
+
+	m.mu.Lock()
+	handler, ok := m.commands[message]
+	m.mu.Unlock()
+	if !ok {
+		logger.I().Warn("Unsupported notification command", "command", message)
+		return
+	}
+	if err := handler(notification); err != nil {
+		logger.I().Error("Notification command failed", "command", message, "error", err)
+	}
+	if notification.Event.HassConfirmId != "" {
+		m.ws.SendCommand(
+			ws.NewOutgoingPushNotificationConfirmation(
+				m.Registration.WebhookID,
+				notification.Event.HassConfirmId),
+		)
+	}
+}
+
 func (m *MobileApp) FreedesktopNotifier(notification *ws.IncomingPushNotificationMessage) {
 	conn, err := dbus.SessionBus()
 	if err != nil {
@@ -0,0 +1,387 @@
+package sensors
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values reported by the audio sensors.
+const (
+	audioVolume     = "volume"
+	audioMuted      = "muted"
+	audioMicrophone = "microphone_in_use"
+)
+
+// audioEvents lists the pactl subscribe facilities that change the state of
+// each audio sensor.
+var audioEvents = map[string][]string{
+	audioVolume:     {"sink", "server"},
+	audioMuted:      {"sink", "server"},
+	audioMicrophone: {"source-output"},
+}
+
+var volumePercentage = regexp.MustCompile(`(\d+)%`)
+
+// Audio reports the volume and mute state of the default output and whether
+// an application is recording from a microphone. It talks to PulseAudio, or
+// PipeWire through pipewire-pulse, with pactl.
+type Audio struct {
+	Sensor
+	property string
+	Timeout  time.Duration
+	events   *audioSubscription
+}
+
+func (a *Audio) GetSensors() []*Sensor {
+	return []*Sensor{&a.Sensor}
+}
+
+func (a *Audio) Enable() {
+	a.Sensor.Disabled = false
+}
+
+func (a *Audio) Disable() {
+	a.Sensor.Disabled = true
+}
+
+func (a *Audio) Update() error {
+	switch a.property {
+	case audioVolume:
+		out, err := pactl(a.Timeout, "get-sink-volume", "@DEFAULT_SINK@")
+		if err != nil {
+			return err
+		}
+		// Volume: front-left: 42597 /  65% / -11.23 dB,   front-right: ...
+		match := volumePercentage.FindStringSubmatch(out)
+		if match == nil {
+			return fmt.Errorf("unexpected pactl output %q", out)
+		}
+		a.State, _ = strconv.Atoi(match[1])
+	case audioMuted:
+		out, err := pactl(a.Timeout, "get-sink-mute", "@DEFAULT_SINK@")
+		if err != nil {
+			return err
+		}
+		// Mute: no
+		a.State = strings.HasSuffix(strings.TrimSpace(out), "yes")
+	case audioMicrophone:
+		out, err := pactl(a.Timeout, "list", "source-outputs")
+		if err != nil {
+			return err
+		}
+		applications := recordingApplications(out)
+		a.State = len(applications) > 0
+		a.Attributes = map[string]any{
+			"applications": applications,
+		}
+	}
+	return nil
+}
+
+// Watch calls notify on the events of the sound server that change the
+// state of this sensor.
+func (a *Audio) Watch(notify func(), stop <-chan struct{}) error {
+	done, err := a.events.add(a, notify)
+	if err != nil {
+		return err
+	}
+	defer a.events.remove(a)
+
+	select {
+	case <-stop:
+		return nil
+	case <-done:
+		return errors.New("pactl subscribe stopped")
+	}
+}
+
+// audioSubscription follows the events of the sound server with a single
+// pactl subscribe for all audio sensors, while any of them is watched.
+type audioSubscription struct {
+	mu       sync.Mutex
+	watchers map[*Audio]func()
+	cancel   context.CancelFunc
+	// done is closed when pactl subscribe exits
+	done chan struct{}
+}
+
+// add passes the events of the sensor on to notify, starting pactl
+// subscribe when needed. The returned channel is closed when it exits.
+func (s *audioSubscription) add(a *Audio, notify func()) (<-chan struct{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done == nil {
+		err := s.start()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.watchers == nil {
+		s.watchers = map[*Audio]func(){}
+	}
+	s.watchers[a] = notify
+	return s.done, nil
+}
+
+// remove stops passing on the events of the sensor, and stops pactl
+// subscribe when no sensor is watched anymore.
+func (s *audioSubscription) remove(a *Audio) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.watchers, a)
+	if len(s.watchers) == 0 && s.cancel != nil {
+		s.cancel()
+		s.cancel, s.done = nil, nil
+	}
+}
+
+func (s *audioSubscription) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, "pactl", "subscribe")
+	cmd.Env = pactlEnv()
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		cancel()
+		return err
+	}
+	done := make(chan struct{})
+	s.cancel, s.done = cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+		// Event 'change' on sink #52
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 4 {
+				continue
+			}
+			s.dispatch(fields[3])
+		}
+		cmd.Wait()
+		s.mu.Lock()
+		if s.done == done {
+			s.cancel, s.done = nil, nil
+		}
+		s.mu.Unlock()
+	}()
+	return nil
+}
+
+// dispatch notifies the sensors whose state changes on events of the
+// facility.
+func (s *audioSubscription) dispatch(facility string) {
+	s.mu.Lock()
+	notify := []func(){}
+	for a, fn := range s.watchers {
+		if contains(audioEvents[a.property], facility) {
+			notify = append(notify, fn)
+		}
+	}
+	s.mu.Unlock()
+	for _, fn := range notify {
+		fn()
+	}
+}
+
+// recordingApplications returns the names of the applications in the output
+// of pactl list source-outputs. The level meters of volume controls like
+// pavucontrol don't count as recording.
+func recordingApplications(out string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	name := ""
+	monitor := false
+	flush := func() {
+		if name != "" && !monitor && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		name, monitor = "", false
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Source Output #"):
+			flush()
+		case strings.HasPrefix(line, "application.name = "):
+			name = strings.Trim(strings.TrimPrefix(line, "application.name = "), `"`)
+		case line == `media.name = "Peak detect"`:
+			monitor = true
+		}
+	}
+	flush()
+	sort.Strings(names)
+	return names
+}
+
+// pactlEnv returns the environment for pactl, whose output is translated
+// and only parsed in English.
+func pactlEnv() []string {
+	return append(os.Environ(), "LC_ALL=C")
+}
+
+func pactl(timeout time.Duration, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "pactl", args...)
+	cmd.Env = pactlEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("pactl %s: %v", args[0], err)
+	}
+	return string(out), nil
+}
+
+// Camera reports whether an application has a video device, like a webcam,
+// open. It has to look at the open files of every process, so it is polled.
+type Camera struct {
+	Sensor
+	interval time.Duration
+}
+
+func (c *Camera) GetSensors() []*Sensor {
+	return []*Sensor{&c.Sensor}
+}
+
+func (c *Camera) Enable() {
+	c.Sensor.Disabled = false
+}
+
+func (c *Camera) Disable() {
+	c.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (c *Camera) Interval() time.Duration {
+	return c.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (c *Camera) SetInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+func (c *Camera) Update() error {
+	applications, err := videoApplications("/proc")
+	if err != nil {
+		return err
+	}
+	c.State = len(applications) > 0
+	c.Attributes = map[string]any{
+		"applications": applications,
+	}
+	return nil
+}
+
+// videoApplications returns the names of the processes with a /dev/video*
+// device open. Processes of other users can't be inspected and are skipped.
+func videoApplications(proc string) ([]string, error) {
+	fds, err := filepath.Glob(filepath.Join(proc, "[0-9]*", "fd", "*"))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	seen := map[string]bool{}
+	for _, fd := range fds {
+		target, err := os.Readlink(fd)
+		if err != nil || !strings.HasPrefix(target, "/dev/video") {
+			continue
+		}
+		pid := filepath.Dir(filepath.Dir(fd))
+		name := readSysfsString(filepath.Join(pid, "comm"))
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func newAudio(events *audioSubscription, property string, sensor Sensor) *Audio {
+	sensor.UniqueID = property
+	if sensor.Type == "" {
+		sensor.Type = "sensor"
+	}
+	return &Audio{
+		Sensor:   sensor,
+		property: property,
+		Timeout:  5 * time.Second,
+		events:   events,
+	}
+}
+
+// DiscoverAudio creates the volume, mute and microphone sensors when pactl
+// can reach a sound server.
+func DiscoverAudio() ([]*Audio, error) {
+	if _, err := exec.LookPath("pactl"); err != nil {
+		return nil, err
+	}
+	events := &audioSubscription{}
+	audio := []*Audio{
+		newAudio(events, audioVolume, Sensor{
+			Name:              "Volume",
+			Icon:              "mdi:volume-high",
+			UnitOfMeasurement: "%",
+			StateClass:        "measurement",
+		}),
+		newAudio(events, audioMuted, Sensor{
+			Name: "Muted",
+			Icon: "mdi:volume-off",
+			Type: "binary_sensor",
+		}),
+		newAudio(events, audioMicrophone, Sensor{
+			Name: "Microphone in use",
+			Icon: "mdi:microphone",
+			Type: "binary_sensor",
+		}),
+	}
+	for _, a := range audio {
+		err := a.Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return audio, nil
+}
+
+// DiscoverCamera creates the camera in use sensor when the system has video
+// devices. It returns nil, without an error, when it has none.
+func DiscoverCamera() (*Camera, error) {
+	devices, _ := filepath.Glob("/dev/video*")
+	if len(devices) == 0 {
+		return nil, nil
+	}
+	camera := &Camera{
+		Sensor: Sensor{
+			Name:     "Camera in use",
+			UniqueID: "camera_in_use",
+			Type:     "binary_sensor",
+			Icon:     "mdi:webcam",
+		},
+		interval: 10 * time.Second,
+	}
+	err := camera.Update()
+	if err != nil {
+		return nil, err
+	}
+	return camera, nil
+}
@@ -1,13 +1,17 @@
 package sensors
 
-import "github.com/prometheus/procfs"
+import (
+	"time"
+
+	"github.com/prometheus/procfs"
+)
 
 type AverageLoad struct {
 	Sensor
+	interval time.Duration
 }
 
 func (a *AverageLoad) GetSensors() []*Sensor {
-	a.Update()
 	return []*Sensor{&a.Sensor}
 }
 
@@ -19,6 +23,16 @@ func (a *AverageLoad) Disable() {
 	a.Sensor.Disabled = true
 }
 
+// Interval returns how often the sensor is polled.
+func (a *AverageLoad) Interval() time.Duration {
+	return a.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (a *AverageLoad) SetInterval(interval time.Duration) {
+	a.interval = interval
+}
+
 func (a *AverageLoad) Update() (err error) {
 	fs, err := procfs.NewDefaultFS()
 
@@ -41,7 +55,7 @@ func (a *AverageLoad) Update() (err error) {
 func DiscoverAverageLoad() (*AverageLoad, error) {
 
 	sensor := AverageLoad{
-		Sensor{
+		Sensor: Sensor{
 			Name:           "load",
 			UniqueID:       "load",
 			Type:           "sensor",
@@ -49,6 +63,7 @@ func DiscoverAverageLoad() (*AverageLoad, error) {
 			EntityCategory: "diagnostic",
 			Disabled:       false,
 		},
+		interval: 30 * time.Second,
 	}
 
 	err := sensor.Update()
@@ -1,20 +1,116 @@
 package sensors
 
 import (
-	"strconv"
+	"errors"
+	"math"
 	"strings"
 
 	"github.com/godbus/dbus/v5"
 )
 
+const (
+	upowerDest   = "org.freedesktop.UPower"
+	upowerPath   = "/org/freedesktop/UPower"
+	upowerDevice = "org.freedesktop.UPower.Device"
+)
+
+// UPower device types that aren't batteries.
+const (
+	upowerTypeUnknown   = 0
+	upowerTypeLinePower = 1
+	upowerTypeBattery   = 2
+)
+
+// Values reported by the battery sensors.
+const (
+	batteryLevel       = "level"
+	batteryCharging    = "state"
+	batteryStatus      = "status"
+	batteryTimeToEmpty = "time_to_empty"
+	batteryTimeToFull  = "time_to_full"
+	batteryEnergyRate  = "energy_rate"
+	batteryCapacity    = "capacity"
+	batteryCycles      = "cycle_count"
+	batteryTechnology  = "technology"
+)
+
+// batteryProperties maps each battery sensor to the UPower device property
+// it reports.
+var batteryProperties = map[string]string{
+	batteryLevel:       "Percentage",
+	batteryCharging:    "State",
+	batteryStatus:      "State",
+	batteryTimeToEmpty: "TimeToEmpty",
+	batteryTimeToFull:  "TimeToFull",
+	batteryEnergyRate:  "EnergyRate",
+	batteryCapacity:    "Capacity",
+	batteryCycles:      "ChargeCycles",
+	batteryTechnology:  "Technology",
+}
+
+// The UPower State enum
+var batteryStates = []string{
+	"unknown",
+	"charging",
+	"discharging",
+	"empty",
+	"fully_charged",
+	"pending_charge",
+	"pending_discharge",
+}
+
+// The UPower Technology enum
+var batteryTechnologies = []string{
+	"unknown",
+	"lithium_ion",
+	"lithium_polymer",
+	"lithium_iron_phosphate",
+	"lead_acid",
+	"nickel_cadmium",
+	"nickel_metal_hydride",
+}
+
+// The UPower Type enum, used to name peripherals without vendor or model.
+var upowerTypes = []string{
+	"unknown",
+	"line power",
+	"battery",
+	"ups",
+	"monitor",
+	"mouse",
+	"keyboard",
+	"pda",
+	"phone",
+	"media player",
+	"tablet",
+	"computer",
+	"gaming input",
+	"pen",
+	"touchpad",
+	"modem",
+	"network",
+	"headset",
+	"speakers",
+	"headphones",
+	"video",
+	"other audio",
+	"remote control",
+	"printer",
+	"scanner",
+	"camera",
+	"wearable",
+	"toy",
+	"bluetooth device",
+}
+
 type Battery struct {
 	Sensor
 	conn     *dbus.Conn
 	dbusPath dbus.ObjectPath
+	property string
 }
 
 func (b *Battery) GetSensors() []*Sensor {
-	b.Update()
 	return []*Sensor{&b.Sensor}
 }
 
@@ -26,76 +122,218 @@ func (b *Battery) Disable() {
 	b.Sensor.Disabled = true
 }
 
-func (b *Battery) Update() error {
-	if strings.HasSuffix(b.UniqueID, "_level") {
-		variant, err := b.conn.Object("org.freedesktop.UPower", b.dbusPath).
-			GetProperty("org.freedesktop.UPower.Device.Percentage")
-		if err != nil {
-			return err
+// Watch follows the UPower PropertiesChanged signal of the battery device and
+// calls notify when the property this sensor reports changes.
+func (b *Battery) Watch(notify func(), stop <-chan struct{}) error {
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(b.dbusPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	err := b.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer b.conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	b.conn.Signal(c)
+	defer b.conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Path != b.dbusPath || v.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(v.Body) < 2 {
+				continue
+			}
+			if iface, _ := v.Body[0].(string); iface != upowerDevice {
+				continue
+			}
+			changed, _ := v.Body[1].(map[string]dbus.Variant)
+			_, reported := changed[batteryProperties[b.property]]
+			_, present := changed["IsPresent"]
+			if reported || present {
+				notify()
+			}
 		}
-		b.State = int(variant.Value().(float64))
-	} else if strings.HasSuffix(b.UniqueID, "_state") {
-		variant, err := b.conn.Object("org.freedesktop.UPower", b.dbusPath).
-			GetProperty("org.freedesktop.UPower.Device.State")
-		if err != nil {
-			return err
+	}
+}
+
+func (b *Battery) Update() error {
+	o := b.conn.Object(upowerDest, b.dbusPath)
+	if present, err := o.GetProperty(upowerDevice + ".IsPresent"); err == nil {
+		if isPresent, _ := present.Value().(bool); !isPresent {
+			// Like a battery removed from its bay
+			b.State = StateUnavailable
+			return nil
 		}
-		state := variant.Value().(uint32)
-		charging := false
-		if state == 1 {
-			charging = true
+	}
+
+	variant, err := o.GetProperty(upowerDevice + "." + batteryProperties[b.property])
+	if err != nil {
+		return err
+	}
+
+	switch b.property {
+	case batteryLevel:
+		percentage, _ := variant.Value().(float64)
+		b.State = int(percentage)
+	case batteryCharging:
+		// Fully charged and pending charge batteries are plugged in as well,
+		// like the battery_charging device class means.
+		state, _ := variant.Value().(uint32)
+		name := enumName(batteryStates, state)
+		b.State = name == "charging" || name == "fully_charged" || name == "pending_charge"
+	case batteryStatus:
+		state, _ := variant.Value().(uint32)
+		b.State = enumName(batteryStates, state)
+	case batteryTimeToEmpty, batteryTimeToFull:
+		// Seconds, 0 when unknown or not charging or discharging
+		seconds, _ := variant.Value().(int64)
+		b.State = math.Round(float64(seconds) / 60)
+	case batteryEnergyRate:
+		rate, _ := variant.Value().(float64)
+		b.State = math.Round(rate*100) / 100
+	case batteryCapacity:
+		capacity, _ := variant.Value().(float64)
+		b.State = math.Round(capacity*10) / 10
+	case batteryCycles:
+		cycles, _ := variant.Value().(int32)
+		if cycles < 0 {
+			b.State = StateUnavailable
+			return errors.New("charge cycles not supported")
 		}
-		b.State = charging
+		b.State = cycles
+	case batteryTechnology:
+		technology, _ := variant.Value().(uint32)
+		b.State = enumName(batteryTechnologies, technology)
 	}
 
 	return nil
 }
 
-func NewBatteryLevel(systemdbus *dbus.Conn, path dbus.ObjectPath, name string, state int, disabled bool) *Battery {
-	ID := name + "_level"
+func enumName(names []string, value uint32) string {
+	if int(value) >= len(names) {
+		return names[0]
+	}
+	return names[value]
+}
 
+func newBattery(systemdbus *dbus.Conn, path dbus.ObjectPath, id, name, property string, sensor Sensor) *Battery {
+	sensor.Name = name + " " + sensor.Name
+	sensor.UniqueID = id + "_" + property
+	if sensor.Type == "" {
+		sensor.Type = "sensor"
+	}
+	sensor.EntityCategory = "diagnostic"
 	return &Battery{
-		Sensor: Sensor{
-			Name:              name,
-			UniqueID:          ID,
-			DeviceClass:       "battery",
-			Icon:              "mdi:battery",
-			State:             strconv.Itoa(state),
-			StateClass:        "measurement",
-			Type:              "sensor",
-			UnitOfMeasurement: "%",
-			EntityCategory:    "diagnostic",
-			Disabled:          disabled,
-		},
+		Sensor:   sensor,
 		conn:     systemdbus,
 		dbusPath: path,
+		property: property,
 	}
 }
 
-func NewBatteryState(systemdbus *dbus.Conn, path dbus.ObjectPath, name string, state bool, disabled bool) *Battery {
-	ID := name + "_state"
-	return &Battery{
-		Sensor: Sensor{
-			Name:           name,
-			UniqueID:       ID,
-			DeviceClass:    "battery_charging",
-			Icon:           "mdi:battery-charging",
-			State:          strconv.FormatBool(state),
-			Type:           "binary_sensor",
-			EntityCategory: "diagnostic",
-			Disabled:       disabled,
-		},
-		conn:     systemdbus,
-		dbusPath: path,
+func NewBatteryLevel(systemdbus *dbus.Conn, path dbus.ObjectPath, id, name string) *Battery {
+	return newBattery(systemdbus, path, id, name, batteryLevel, Sensor{
+		Name:              "level",
+		DeviceClass:       "battery",
+		Icon:              "mdi:battery",
+		StateClass:        "measurement",
+		UnitOfMeasurement: "%",
+	})
+}
+
+func NewBatteryState(systemdbus *dbus.Conn, path dbus.ObjectPath, id, name string) *Battery {
+	return newBattery(systemdbus, path, id, name, batteryCharging, Sensor{
+		Name:        "charging",
+		DeviceClass: "battery_charging",
+		Icon:        "mdi:battery-charging",
+		Type:        "binary_sensor",
+	})
+}
+
+func NewBatteryStatus(systemdbus *dbus.Conn, path dbus.ObjectPath, id, name string) *Battery {
+	return newBattery(systemdbus, path, id, name, batteryStatus, Sensor{
+		Name: "status",
+		Icon: "mdi:battery-sync",
+	})
+}
+
+// newBatteryDetails creates the sensors only laptop batteries and UPSes
+// report.
+func newBatteryDetails(systemdbus *dbus.Conn, path dbus.ObjectPath, id, name string) []*Battery {
+	return []*Battery{
+		newBattery(systemdbus, path, id, name, batteryTimeToEmpty, Sensor{
+			Name:              "time to empty",
+			Icon:              "mdi:battery-arrow-down",
+			DeviceClass:       "duration",
+			UnitOfMeasurement: "min",
+		}),
+		newBattery(systemdbus, path, id, name, batteryTimeToFull, Sensor{
+			Name:              "time to full",
+			Icon:              "mdi:battery-arrow-up",
+			DeviceClass:       "duration",
+			UnitOfMeasurement: "min",
+		}),
+		newBattery(systemdbus, path, id, name, batteryEnergyRate, Sensor{
+			Name:              "energy rate",
+			Icon:              "mdi:flash",
+			DeviceClass:       "power",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "W",
+		}),
+		newBattery(systemdbus, path, id, name, batteryCapacity, Sensor{
+			Name:              "health",
+			Icon:              "mdi:battery-heart-variant",
+			StateClass:        "measurement",
+			UnitOfMeasurement: "%",
+		}),
+		newBattery(systemdbus, path, id, name, batteryCycles, Sensor{
+			Name:       "charge cycles",
+			Icon:       "mdi:battery-sync-outline",
+			StateClass: "total_increasing",
+		}),
+		newBattery(systemdbus, path, id, name, batteryTechnology, Sensor{
+			Name: "technology",
+			Icon: "mdi:battery-outline",
+		}),
+	}
+}
+
+// batteryName returns the vendor and model of a device, or its type when
+// UPower doesn't know them.
+func batteryName(o dbus.BusObject, deviceType uint32) string {
+	parts := []string{}
+	for _, property := range []string{"Vendor", "Model"} {
+		if value := strings.TrimSpace(stringProperty(o, upowerDevice+"."+property)); value != "" {
+			parts = append(parts, value)
+		}
+	}
+	if len(parts) > 0 {
+		return strings.Join(parts, " ")
+	}
+	if deviceType == upowerTypeBattery {
+		return "Battery"
 	}
+	return strings.ToUpper(enumName(upowerTypes, deviceType)[:1]) + enumName(upowerTypes, deviceType)[1:]
 }
 
+// DiscoverBatteries creates sensors for the batteries UPower knows about:
+// the batteries of the system, with all details UPower reports, and those of
+// peripherals like mice, keyboards and headsets, with their level and
+// status.
 func DiscoverBatteries(systemdbus *dbus.Conn) ([]*Battery, error) {
 	s := []dbus.ObjectPath{}
 	batteries := []*Battery{}
 
-	err := systemdbus.Object("org.freedesktop.UPower", "/org/freedesktop/UPower").
-		Call("org.freedesktop.UPower.EnumerateDevices", 0).
+	err := systemdbus.Object(upowerDest, upowerPath).
+		Call(upowerDest+".EnumerateDevices", 0).
 		Store(&s)
 
 	if err != nil {
@@ -103,42 +341,47 @@ func DiscoverBatteries(systemdbus *dbus.Conn) ([]*Battery, error) {
 	}
 
 	for _, path := range s {
-		percentage := 0
-		present := true
-		o := systemdbus.Object("org.freedesktop.UPower", path)
-		deviceType, err := o.GetProperty("org.freedesktop.UPower.Device.Type")
+		o := systemdbus.Object(upowerDest, path)
+		variant, err := o.GetProperty(upowerDevice + ".Type")
 		if err != nil {
 			return batteries, err
 		}
-		if deviceType.Value().(uint32) == 2 {
-
-			variant, err := o.GetProperty("org.freedesktop.UPower.Device.NativePath")
-			if err != nil {
-				return batteries, err
-			}
-			name := variant.Value().(string)
+		deviceType, _ := variant.Value().(uint32)
+		if deviceType == upowerTypeUnknown || deviceType == upowerTypeLinePower {
+			continue
+		}
 
-			variant, err = o.GetProperty("org.freedesktop.UPower.Device.Percentage")
-			if err != nil {
-				return batteries, err
+		// The native path, like BAT0, is stable across boots and used for
+		// the unique IDs of system batteries. Peripherals use a path like
+		// /org/bluez/hci0/dev_..., so those are turned into a slug.
+		nativePath := stringProperty(o, upowerDevice+".NativePath")
+		id := nativePath
+		if deviceType != upowerTypeBattery || id == "" {
+			id = slug(nativePath)
+			if id == "" {
+				id = slug(string(path))
 			}
-			percentage = int(variant.Value().(float64))
+		}
+		name := batteryName(o, deviceType)
 
-			variant, err = o.GetProperty("org.freedesktop.UPower.Device.State")
-			if err != nil {
-				return batteries, err
+		batteries = append(batteries,
+			NewBatteryLevel(systemdbus, path, id, name),
+			NewBatteryState(systemdbus, path, id, name),
+			NewBatteryStatus(systemdbus, path, id, name),
+		)
+		supply, _ := o.GetProperty(upowerDevice + ".PowerSupply")
+		if isSupply, _ := supply.Value().(bool); isSupply {
+			for _, b := range newBatteryDetails(systemdbus, path, id, name) {
+				// Not every battery reports every detail, like the cycle count
+				if err := b.Update(); err == nil {
+					batteries = append(batteries, b)
+				}
 			}
-			state := variant.Value().(uint32)
-			charging := false
-			if state == 1 {
-				charging = true
-			}
-
-			batteries = append(batteries, NewBatteryLevel(systemdbus, path, name, percentage, !present))
-			batteries = append(batteries, NewBatteryState(systemdbus, path, name, charging, !present))
-
 		}
 	}
 
+	for _, b := range batteries {
+		b.Update()
+	}
 	return batteries, nil
 }
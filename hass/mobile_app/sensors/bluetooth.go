@@ -0,0 +1,302 @@
+package sensors
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	bluezDest    = "org.bluez"
+	bluezAdapter = "org.bluez.Adapter1"
+	bluezDevice  = "org.bluez.Device1"
+	bluezBattery = "org.bluez.Battery1"
+)
+
+// Values reported by the Bluetooth sensors.
+const (
+	bluetoothPowered   = "bluetooth_powered"
+	bluetoothConnected = "bluetooth_connected_devices"
+	bluetoothDevice    = "bluetooth_device"
+)
+
+// Bluetooth reports whether Bluetooth is on, the connected devices, or
+// whether a single paired device is connected, from BlueZ.
+type Bluetooth struct {
+	Sensor
+	probe    *bluezProbe
+	property string
+	// Address of the device, for bluetooth_device sensors
+	address string
+}
+
+func (b *Bluetooth) GetSensors() []*Sensor {
+	return []*Sensor{&b.Sensor}
+}
+
+func (b *Bluetooth) Enable() {
+	b.Sensor.Disabled = false
+}
+
+func (b *Bluetooth) Disable() {
+	b.Sensor.Disabled = true
+}
+
+func (b *Bluetooth) Update() error {
+	state, err := b.probe.Get()
+	if err != nil {
+		return err
+	}
+
+	switch b.property {
+	case bluetoothPowered:
+		b.State = state.powered
+		b.Attributes = map[string]any{
+			"adapters": state.adapters,
+		}
+	case bluetoothConnected:
+		devices := []map[string]any{}
+		for _, device := range state.devices {
+			if device.Connected {
+				devices = append(devices, device.attributes())
+			}
+		}
+		b.State = len(devices)
+		b.Attributes = map[string]any{
+			"devices": devices,
+		}
+	case bluetoothDevice:
+		b.State = false
+		b.Attributes = nil
+		for _, device := range state.devices {
+			if device.Address == b.address {
+				b.State = device.Connected
+				b.Attributes = device.attributes()
+			}
+		}
+	}
+	return nil
+}
+
+// Watch follows the signals of BlueZ and calls notify when adapters or
+// devices change, appear or go away.
+func (b *Bluetooth) Watch(notify func(), stop <-chan struct{}) error {
+	conn := b.probe.conn
+	options := []dbus.MatchOption{
+		dbus.WithMatchSender(bluezDest),
+	}
+	err := conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	conn.Signal(c)
+	defer conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			// Other services share the match on the same connection, so
+			// only look at BlueZ objects.
+			path := v.Path
+			switch v.Name {
+			case "org.freedesktop.DBus.ObjectManager.InterfacesAdded",
+				"org.freedesktop.DBus.ObjectManager.InterfacesRemoved":
+				if len(v.Body) < 1 {
+					continue
+				}
+				path, _ = v.Body[0].(dbus.ObjectPath)
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				if len(v.Body) < 1 {
+					continue
+				}
+				iface, _ := v.Body[0].(string)
+				if iface != bluezAdapter && iface != bluezDevice && iface != bluezBattery {
+					continue
+				}
+			default:
+				continue
+			}
+			if !strings.HasPrefix(string(path), "/org/bluez/") {
+				continue
+			}
+			b.probe.Invalidate()
+			notify()
+		}
+	}
+}
+
+type bluezDeviceInfo struct {
+	Name      string
+	Address   string
+	Icon      string
+	Class     uint32
+	Paired    bool
+	Connected bool
+	// Battery percentage, -1 when unknown
+	Battery int
+}
+
+func (d bluezDeviceInfo) attributes() map[string]any {
+	attributes := map[string]any{
+		"name":    d.Name,
+		"address": d.Address,
+		"type":    d.Icon,
+		"class":   d.Class,
+	}
+	if d.Battery >= 0 {
+		attributes["battery"] = d.Battery
+	}
+	return attributes
+}
+
+type bluezState struct {
+	powered  bool
+	adapters []string
+	devices  []bluezDeviceInfo
+}
+
+// bluezProbe reads the adapters and devices of BlueZ, sharing the result
+// between the Bluetooth sensors for a short while.
+type bluezProbe struct {
+	mu      sync.Mutex
+	conn    *dbus.Conn
+	state   *bluezState
+	updated time.Time
+}
+
+func (p *bluezProbe) Get() (*bluezState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state != nil && time.Since(p.updated) < time.Second {
+		return p.state, nil
+	}
+
+	objects := map[dbus.ObjectPath]map[string]map[string]dbus.Variant{}
+	err := p.conn.Object(bluezDest, "/").
+		Call("org.freedesktop.DBus.ObjectManager.GetManagedObjects", 0).
+		Store(&objects)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &bluezState{adapters: []string{}, devices: []bluezDeviceInfo{}}
+	for _, interfaces := range objects {
+		if adapter, ok := interfaces[bluezAdapter]; ok {
+			name, _ := adapter["Alias"].Value().(string)
+			state.adapters = append(state.adapters, name)
+			if powered, _ := adapter["Powered"].Value().(bool); powered {
+				state.powered = true
+			}
+		}
+		device, ok := interfaces[bluezDevice]
+		if !ok {
+			continue
+		}
+		info := bluezDeviceInfo{Battery: -1}
+		info.Name, _ = device["Alias"].Value().(string)
+		info.Address, _ = device["Address"].Value().(string)
+		info.Icon, _ = device["Icon"].Value().(string)
+		info.Class, _ = device["Class"].Value().(uint32)
+		info.Paired, _ = device["Paired"].Value().(bool)
+		info.Connected, _ = device["Connected"].Value().(bool)
+		if battery, ok := interfaces[bluezBattery]; ok {
+			if percentage, ok := battery["Percentage"].Value().(byte); ok {
+				info.Battery = int(percentage)
+			}
+		}
+		state.devices = append(state.devices, info)
+	}
+	sort.Strings(state.adapters)
+	sort.Slice(state.devices, func(i, j int) bool {
+		return state.devices[i].Address < state.devices[j].Address
+	})
+
+	p.state = state
+	p.updated = time.Now()
+	return state, nil
+}
+
+// Invalidate makes the next Get query BlueZ again.
+func (p *bluezProbe) Invalidate() {
+	p.mu.Lock()
+	p.updated = time.Time{}
+	p.mu.Unlock()
+}
+
+// DiscoverBluetooth creates the Bluetooth powered and connected devices
+// sensors when BlueZ has an adapter. Paired devices whose name or address
+// matches one of the devices glob patterns get a connected sensor of their
+// own. It returns none, without an error, when BlueZ has no adapter.
+func DiscoverBluetooth(systemdbus *dbus.Conn, devices []string) ([]*Bluetooth, error) {
+	probe := &bluezProbe{conn: systemdbus}
+	state, err := probe.Get()
+	if err != nil {
+		return nil, err
+	}
+	if len(state.adapters) == 0 {
+		return nil, nil
+	}
+
+	found := []*Bluetooth{
+		{
+			Sensor: Sensor{
+				Name:     "Bluetooth",
+				UniqueID: bluetoothPowered,
+				Type:     "binary_sensor",
+				Icon:     "mdi:bluetooth",
+			},
+			probe:    probe,
+			property: bluetoothPowered,
+		},
+		{
+			Sensor: Sensor{
+				Name:       "Bluetooth connected devices",
+				UniqueID:   bluetoothConnected,
+				Type:       "sensor",
+				Icon:       "mdi:bluetooth-connect",
+				StateClass: "measurement",
+			},
+			probe:    probe,
+			property: bluetoothConnected,
+		},
+	}
+	for _, device := range state.devices {
+		if !device.Paired {
+			continue
+		}
+		if !matchPattern(devices, device.Address) && !matchPattern(devices, device.Name) {
+			continue
+		}
+		found = append(found, &Bluetooth{
+			Sensor: Sensor{
+				Name:        device.Name + " connected",
+				UniqueID:    "bluetooth_" + slug(device.Address),
+				Type:        "binary_sensor",
+				Icon:        "mdi:bluetooth-audio",
+				DeviceClass: "connectivity",
+			},
+			probe:    probe,
+			property: bluetoothDevice,
+			address:  device.Address,
+		})
+	}
+
+	for _, b := range found {
+		err := b.Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,183 @@
+package sensors
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Command is a sensor that runs a shell command and uses its output as
+// state. The output can be plain text, a number or a JSON object with a
+// state and attributes:
+//
+//	{"state": 42, "attributes": {"queued": 3}}
+//
+// Text is only reported as a number when the sensor has a unit or state
+// class, so a version like 1.10 stays as it is.
+type Command struct {
+	Sensor
+	Command  string
+	Timeout  time.Duration
+	interval time.Duration
+}
+
+type commandOutput struct {
+	State      any            `json:"state"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+func (c *Command) GetSensors() []*Sensor {
+	return []*Sensor{&c.Sensor}
+}
+
+func (c *Command) Enable() {
+	c.Sensor.Disabled = false
+}
+
+func (c *Command) Disable() {
+	c.Sensor.Disabled = true
+}
+
+// Interval returns how often the command runs.
+func (c *Command) Interval() time.Duration {
+	return c.interval
+}
+
+// SetInterval changes how often the command runs.
+func (c *Command) SetInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+// Update runs the command. When it fails, the sensor becomes unavailable.
+func (c *Command) Update() error {
+	state, attributes, err := c.run()
+	if err != nil {
+		c.State = StateUnavailable
+		c.Attributes = map[string]any{
+			"error": err.Error(),
+		}
+		return err
+	}
+	c.State = state
+	c.Attributes = attributes
+	return nil
+}
+
+func (c *Command) run() (any, map[string]any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("sh", "-c", c.Command)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Run the shell in a process group of its own, so its children are
+	// killed along with it on a timeout and don't hold on to the output.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	err := cmd.Start()
+	if err != nil {
+		return nil, nil, err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		err = <-done
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, nil, fmt.Errorf("command timed out after %v", c.Timeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, nil, fmt.Errorf("%v: %s", err, msg)
+		}
+		return nil, nil, err
+	}
+
+	return c.parse(strings.TrimSpace(stdout.String()))
+}
+
+// parse maps the output of the command to a state and attributes.
+func (c *Command) parse(output string) (any, map[string]any, error) {
+	if output == "" {
+		return nil, nil, errors.New("command returned no output")
+	}
+
+	var state any = output
+	var attributes map[string]any
+	if strings.HasPrefix(output, "{") {
+		var out commandOutput
+		if err := json.Unmarshal([]byte(output), &out); err != nil {
+			return nil, nil, fmt.Errorf("invalid JSON output: %v", err)
+		}
+		if out.State == nil {
+			return nil, nil, errors.New("JSON output has no state")
+		}
+		state = out.State
+		attributes = out.Attributes
+	}
+
+	if text, ok := state.(string); ok {
+		if c.Type == "binary_sensor" {
+			on, err := parseBinaryState(text)
+			if err != nil {
+				return nil, nil, err
+			}
+			state = on
+		} else if c.UnitOfMeasurement != "" || c.StateClass != "" {
+			if number, err := strconv.ParseFloat(text, 64); err == nil {
+				state = number
+			}
+		}
+	}
+
+	return state, attributes, nil
+}
+
+func parseBinaryState(text string) (bool, error) {
+	switch strings.ToLower(text) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	on, err := strconv.ParseBool(text)
+	if err != nil {
+		return false, fmt.Errorf("invalid binary state %q", text)
+	}
+	return on, nil
+}
+
+// NewCommand creates a sensor that runs command every interval, killing it
+// when it runs longer than timeout.
+func NewCommand(sensor Sensor, command string, interval, timeout time.Duration) *Command {
+	if sensor.Type == "" {
+		sensor.Type = "sensor"
+	}
+	if sensor.Icon == "" {
+		sensor.Icon = "mdi:console"
+	}
+	if interval == 0 {
+		interval = 60 * time.Second
+	}
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	return &Command{
+		Sensor:   sensor,
+		Command:  command,
+		Timeout:  timeout,
+		interval: interval,
+	}
+}
@@ -0,0 +1,116 @@
+package sensors
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		sensor     Sensor
+		output     string
+		state      any
+		attributes map[string]any
+		err        bool
+	}{
+		{
+			name:   "text",
+			output: "running",
+			state:  "running",
+		},
+		{
+			name:   "number without unit",
+			output: "1.10",
+			state:  "1.10",
+		},
+		{
+			name:   "number with unit",
+			sensor: Sensor{UnitOfMeasurement: "°C"},
+			output: "42.5",
+			state:  42.5,
+		},
+		{
+			name:   "number with state class",
+			sensor: Sensor{StateClass: "measurement"},
+			output: "3",
+			state:  3.0,
+		},
+		{
+			name:   "text with unit",
+			sensor: Sensor{UnitOfMeasurement: "°C"},
+			output: "unknown",
+			state:  "unknown",
+		},
+		{
+			name:       "json",
+			output:     `{"state": 42, "attributes": {"queued": 3}}`,
+			state:      42.0,
+			attributes: map[string]any{"queued": 3.0},
+		},
+		{
+			name:   "json text state",
+			output: `{"state": "1.10"}`,
+			state:  "1.10",
+		},
+		{
+			name:   "json without state",
+			output: `{"attributes": {"queued": 3}}`,
+			err:    true,
+		},
+		{
+			name:   "invalid json",
+			output: `{"state": `,
+			err:    true,
+		},
+		{
+			name:   "binary on",
+			sensor: Sensor{Type: "binary_sensor"},
+			output: "ON",
+			state:  true,
+		},
+		{
+			name:   "binary off",
+			sensor: Sensor{Type: "binary_sensor"},
+			output: "0",
+			state:  false,
+		},
+		{
+			name:   "binary json",
+			sensor: Sensor{Type: "binary_sensor"},
+			output: `{"state": "yes"}`,
+			state:  true,
+		},
+		{
+			name:   "invalid binary",
+			sensor: Sensor{Type: "binary_sensor"},
+			output: "maybe",
+			err:    true,
+		},
+		{
+			name: "no output",
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Command{Sensor: tt.sensor}
+			state, attributes, err := c.parse(tt.output)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("parse(%q) = %v, want an error", tt.output, state)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parse(%q) failed: %v", tt.output, err)
+			}
+			if state != tt.state {
+				t.Errorf("state = %v (%T), want %v (%T)", state, state, tt.state, tt.state)
+			}
+			if !reflect.DeepEqual(attributes, tt.attributes) {
+				t.Errorf("attributes = %v, want %v", attributes, tt.attributes)
+			}
+		})
+	}
+}
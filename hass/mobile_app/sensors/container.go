@@ -0,0 +1,505 @@
+package sensors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values reported by the container sensors.
+const (
+	containersRunning = "containers_running"
+	containersStopped = "containers_stopped"
+	containerState    = "container"
+)
+
+// Container reports the number of running or stopped containers, or the
+// state of a single container, of Docker or Podman. The number of paused
+// containers is an attribute of both counts.
+type Container struct {
+	Sensor
+	probe    *containerProbe
+	events   *containerEvents
+	property string
+	// Name of the container, for container sensors
+	container string
+}
+
+func (c *Container) GetSensors() []*Sensor {
+	return []*Sensor{&c.Sensor}
+}
+
+func (c *Container) Enable() {
+	c.Sensor.Disabled = false
+}
+
+func (c *Container) Disable() {
+	c.Sensor.Disabled = true
+}
+
+func (c *Container) Update() error {
+	containers, err := c.probe.Get()
+	if err != nil {
+		return err
+	}
+
+	switch c.property {
+	case containersRunning, containersStopped:
+		list := []map[string]any{}
+		paused := 0
+		for _, container := range containers {
+			if container.State == "paused" {
+				paused++
+			}
+			if c.property == containersRunning && container.running() ||
+				c.property == containersStopped && container.stopped() {
+				list = append(list, container.attributes())
+			}
+		}
+		c.State = len(list)
+		c.Attributes = map[string]any{
+			"containers": list,
+			"paused":     paused,
+			"runtime":    c.probe.client.runtime,
+		}
+	case containerState:
+		c.State = StateUnavailable
+		c.Attributes = nil
+		for _, container := range containers {
+			if container.name() == c.container {
+				c.State = container.State
+				c.Attributes = container.attributes()
+			}
+		}
+	}
+	return nil
+}
+
+// Watch calls notify when a container changes.
+func (c *Container) Watch(notify func(), stop <-chan struct{}) error {
+	done, err := c.events.add(c, notify)
+	if err != nil {
+		return err
+	}
+	defer c.events.remove(c)
+
+	select {
+	case <-stop:
+		return nil
+	case <-done:
+		return c.events.error()
+	}
+}
+
+// containerEvents follows the event stream of the container runtime for all
+// container sensors, while any of them is watched.
+type containerEvents struct {
+	mu       sync.Mutex
+	probe    *containerProbe
+	watchers map[*Container]func()
+	cancel   context.CancelFunc
+	// done is closed when the event stream ends, with the reason in err
+	done chan struct{}
+	err  error
+}
+
+// add passes the events on to notify, opening the event stream when needed.
+// The returned channel is closed when the stream ends.
+func (e *containerEvents) add(c *Container, notify func()) (<-chan struct{}, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done == nil {
+		err := e.start()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if e.watchers == nil {
+		e.watchers = map[*Container]func(){}
+	}
+	e.watchers[c] = notify
+	return e.done, nil
+}
+
+// remove stops passing on the events to the sensor, and closes the event
+// stream when no sensor is watched anymore.
+func (e *containerEvents) remove(c *Container) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.watchers, c)
+	if len(e.watchers) == 0 && e.cancel != nil {
+		e.cancel()
+		e.cancel, e.done = nil, nil
+	}
+}
+
+// error returns why the last event stream ended.
+func (e *containerEvents) error() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+func (e *containerEvents) start() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	filters := url.QueryEscape(`{"type":["container"]}`)
+	body, err := e.probe.client.stream(ctx, "/events?filters="+filters)
+	if err != nil {
+		cancel()
+		return err
+	}
+	done := make(chan struct{})
+	e.cancel, e.done = cancel, done
+
+	go func() {
+		defer close(done)
+		defer body.Close()
+		decoder := json.NewDecoder(body)
+		for {
+			var event struct {
+				Action string `json:"Action"`
+			}
+			err := decoder.Decode(&event)
+			if err != nil {
+				e.mu.Lock()
+				e.err = fmt.Errorf("container events: %v", err)
+				if e.done == done {
+					e.cancel, e.done = nil, nil
+				}
+				e.mu.Unlock()
+				cancel()
+				return
+			}
+			// Health checks run exec sessions, which aren't worth an update
+			if strings.HasPrefix(event.Action, "exec_") {
+				continue
+			}
+			e.probe.Invalidate()
+			e.dispatch()
+		}
+	}()
+	return nil
+}
+
+// dispatch notifies all watched sensors.
+func (e *containerEvents) dispatch() {
+	e.mu.Lock()
+	notify := []func(){}
+	for _, fn := range e.watchers {
+		notify = append(notify, fn)
+	}
+	e.mu.Unlock()
+	for _, fn := range notify {
+		fn()
+	}
+}
+
+// containerInfo is a container as listed by GET /containers/json.
+type containerInfo struct {
+	ID     string   `json:"Id"`
+	Names  []string `json:"Names"`
+	Image  string   `json:"Image"`
+	State  string   `json:"State"`
+	Status string   `json:"Status"`
+}
+
+func (c containerInfo) name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+func (c containerInfo) running() bool {
+	return c.State == "running"
+}
+
+// stopped reports whether the container exited. Paused, created or
+// restarting containers are neither running nor stopped.
+func (c containerInfo) stopped() bool {
+	return c.State == "exited" || c.State == "dead"
+}
+
+// health returns the health check status from the status text, like "Up 2
+// hours (healthy)", or "none" for containers without a health check.
+func (c containerInfo) health() string {
+	switch {
+	case strings.Contains(c.Status, "(healthy)"):
+		return "healthy"
+	case strings.Contains(c.Status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.Contains(c.Status, "(health: starting)"), strings.Contains(c.Status, "(starting)"):
+		return "starting"
+	}
+	return "none"
+}
+
+func (c containerInfo) attributes() map[string]any {
+	id := c.ID
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return map[string]any{
+		"name":   c.name(),
+		"id":     id,
+		"image":  c.Image,
+		"state":  c.State,
+		"status": c.Status,
+		"health": c.health(),
+	}
+}
+
+// containerClient talks to the Docker compatible API of Docker or Podman
+// over its unix socket.
+type containerClient struct {
+	http    *http.Client
+	runtime string
+}
+
+func newContainerClient(socket string) *containerClient {
+	return &containerClient{
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// do sends a request and returns the response when its status is below 400.
+// The host of the URL is ignored by the transport.
+func (c *containerClient) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://localhost"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body.Message == "" {
+			body.Message = resp.Status
+		}
+		return nil, fmt.Errorf("%s %s: %s", method, path, body.Message)
+	}
+	return resp, nil
+}
+
+func (c *containerClient) get(path string, v any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := c.do(ctx, http.MethodGet, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *containerClient) post(path string) error {
+	// Stopping waits for the container to exit, 10 seconds by default
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	resp, err := c.do(ctx, http.MethodPost, path)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// stream returns the body of a streaming response, until ctx is done.
+func (c *containerClient) stream(ctx context.Context, path string) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, http.MethodGet, path)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// containerSockets returns the sockets to try, in order: the ones set by
+// DOCKER_HOST or CONTAINER_HOST, Docker, rootless Podman and Podman.
+func containerSockets() []string {
+	sockets := []string{}
+	for _, env := range []string{"DOCKER_HOST", "CONTAINER_HOST"} {
+		if host := os.Getenv(env); strings.HasPrefix(host, "unix://") {
+			sockets = append(sockets, strings.TrimPrefix(host, "unix://"))
+		}
+	}
+	sockets = append(sockets, "/var/run/docker.sock")
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		sockets = append(sockets, filepath.Join(runtime, "podman", "podman.sock"))
+	}
+	return append(sockets, "/run/podman/podman.sock")
+}
+
+// findContainerClient returns a client for the first socket that answers.
+func findContainerClient() (*containerClient, error) {
+	err := errors.New("no Docker or Podman socket found")
+	for _, socket := range containerSockets() {
+		if _, statErr := os.Stat(socket); statErr != nil {
+			continue
+		}
+		client := newContainerClient(socket)
+		var version struct {
+			Components []struct {
+				Name string `json:"Name"`
+			} `json:"Components"`
+		}
+		if err = client.get("/version", &version); err != nil {
+			continue
+		}
+		client.runtime = "docker"
+		for _, component := range version.Components {
+			if strings.Contains(strings.ToLower(component.Name), "podman") {
+				client.runtime = "podman"
+			}
+		}
+		return client, nil
+	}
+	return nil, err
+}
+
+// containerProbe lists the containers, sharing the result between the
+// container sensors for a short while.
+type containerProbe struct {
+	mu         sync.Mutex
+	client     *containerClient
+	containers []containerInfo
+	updated    time.Time
+}
+
+func (p *containerProbe) Get() ([]containerInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.containers != nil && time.Since(p.updated) < time.Second {
+		return p.containers, nil
+	}
+
+	containers := []containerInfo{}
+	err := p.client.get("/containers/json?all=true", &containers)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].name() < containers[j].name()
+	})
+
+	p.containers = containers
+	p.updated = time.Now()
+	return containers, nil
+}
+
+// Invalidate makes the next Get list the containers again.
+func (p *containerProbe) Invalidate() {
+	p.mu.Lock()
+	p.updated = time.Time{}
+	p.mu.Unlock()
+}
+
+// ControlContainer starts, stops or restarts the container with the given
+// name or ID.
+func ControlContainer(container, command string) error {
+	switch command {
+	case "start", "stop", "restart":
+	default:
+		return fmt.Errorf("unknown container command %q", command)
+	}
+	if container == "" {
+		return errors.New("no container given")
+	}
+	client, err := findContainerClient()
+	if err != nil {
+		return err
+	}
+	return client.post("/containers/" + url.PathEscape(container) + "/" + command)
+}
+
+// DiscoverContainers creates the running and stopped containers sensors
+// when Docker or Podman answers on its socket. Containers whose name
+// matches one of the containers glob patterns get a sensor of their own.
+func DiscoverContainers(containers []string) ([]*Container, error) {
+	client, err := findContainerClient()
+	if err != nil {
+		return nil, err
+	}
+	probe := &containerProbe{client: client}
+	events := &containerEvents{probe: probe}
+	list, err := probe.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	found := []*Container{
+		{
+			Sensor: Sensor{
+				Name:       "Running containers",
+				UniqueID:   containersRunning,
+				Type:       "sensor",
+				Icon:       "mdi:docker",
+				StateClass: "measurement",
+			},
+			probe:    probe,
+			events:   events,
+			property: containersRunning,
+		},
+		{
+			Sensor: Sensor{
+				Name:       "Stopped containers",
+				UniqueID:   containersStopped,
+				Type:       "sensor",
+				Icon:       "mdi:docker",
+				StateClass: "measurement",
+			},
+			probe:    probe,
+			events:   events,
+			property: containersStopped,
+		},
+	}
+	for _, container := range list {
+		name := container.name()
+		if !matchPattern(containers, name) {
+			continue
+		}
+		found = append(found, &Container{
+			Sensor: Sensor{
+				Name:     "Container " + name,
+				UniqueID: "container_" + slug(name),
+				Type:     "sensor",
+				Icon:     "mdi:package-variant-closed",
+			},
+			probe:     probe,
+			events:    events,
+			property:  containerState,
+			container: name,
+		})
+	}
+
+	for _, c := range found {
+		err := c.Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,248 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/prometheus/procfs"
+	"github.com/prometheus/procfs/sysfs"
+)
+
+// Values reported by the CPU sensors.
+const (
+	cpuUsage            = "cpu_usage"
+	cpuFrequency        = "cpu_frequency"
+	cpuProcessesRunning = "processes_running"
+	cpuProcessesBlocked = "processes_blocked"
+)
+
+type CPU struct {
+	Sensor
+	probe    *cpuProbe
+	property string
+	interval time.Duration
+}
+
+func (c *CPU) GetSensors() []*Sensor {
+	return []*Sensor{&c.Sensor}
+}
+
+func (c *CPU) Enable() {
+	c.Sensor.Disabled = false
+}
+
+func (c *CPU) Disable() {
+	c.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (c *CPU) Interval() time.Duration {
+	return c.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (c *CPU) SetInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+func (c *CPU) Update() error {
+	sample, err := c.probe.Get()
+	if err != nil {
+		return err
+	}
+
+	switch c.property {
+	case cpuUsage:
+		c.State = sample.usage
+		cores := map[string]any{}
+		for core, usage := range sample.cores {
+			cores[fmt.Sprintf("cpu%d", core)] = usage
+		}
+		c.Attributes = cores
+	case cpuFrequency:
+		c.State = sample.frequency
+		c.Attributes = map[string]any{
+			"min": sample.minFrequency,
+			"max": sample.maxFrequency,
+		}
+	case cpuProcessesRunning:
+		c.State = sample.stat.ProcessesRunning
+	case cpuProcessesBlocked:
+		c.State = sample.stat.ProcessesBlocked
+	}
+	return nil
+}
+
+type cpuSample struct {
+	stat  procfs.Stat
+	usage float64
+	// Utilisation per core, by core number
+	cores        map[int64]float64
+	frequency    float64
+	minFrequency float64
+	maxFrequency float64
+}
+
+// cpuProbe reads /proc/stat and computes the utilisation since the previous
+// read, sharing the result between the CPU sensors for a short while.
+type cpuProbe struct {
+	mu       sync.Mutex
+	fs       procfs.FS
+	sys      sysfs.FS
+	previous *procfs.Stat
+	sample   *cpuSample
+	updated  time.Time
+}
+
+func (p *cpuProbe) Get() (*cpuSample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sample != nil && time.Since(p.updated) < time.Second {
+		return p.sample, nil
+	}
+
+	stat, err := p.fs.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	sample := &cpuSample{
+		stat:  stat,
+		cores: map[int64]float64{},
+	}
+	previous := procfs.Stat{CPU: map[int64]procfs.CPUStat{}}
+	if p.previous != nil {
+		previous = *p.previous
+	}
+	sample.usage = cpuUtilisation(previous.CPUTotal, stat.CPUTotal)
+	for core, cpu := range stat.CPU {
+		sample.cores[core] = cpuUtilisation(previous.CPU[core], cpu)
+	}
+
+	sample.frequency, sample.minFrequency, sample.maxFrequency, err = cpuFrequencies(p.sys)
+	if err != nil && p.sample != nil {
+		// Keep the last known frequencies
+		sample.frequency = p.sample.frequency
+		sample.minFrequency = p.sample.minFrequency
+		sample.maxFrequency = p.sample.maxFrequency
+	}
+
+	p.previous = &stat
+	p.sample = sample
+	p.updated = time.Now()
+	return sample, nil
+}
+
+// cpuUtilisation returns the percentage of time the cpu was busy between
+// two reads of /proc/stat.
+func cpuUtilisation(previous, current procfs.CPUStat) float64 {
+	idle := (current.Idle + current.Iowait) - (previous.Idle + previous.Iowait)
+	total := cpuTotal(current) - cpuTotal(previous)
+	if total <= 0 {
+		return 0
+	}
+	return math.Round((1-idle/total)*10000) / 100
+}
+
+func cpuTotal(s procfs.CPUStat) float64 {
+	// Guest time is already accounted for in user and nice.
+	return s.User + s.Nice + s.System + s.Idle + s.Iowait + s.IRQ + s.SoftIRQ + s.Steal
+}
+
+// cpuFrequencies returns the average current, the minimum and the maximum
+// frequency of all cores in MHz.
+func cpuFrequencies(sys sysfs.FS) (current, minimum, maximum float64, err error) {
+	stats, err := sys.SystemCpufreq()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var sum float64
+	var count int
+	for _, s := range stats {
+		freq := s.ScalingCurrentFrequency
+		if freq == nil {
+			freq = s.CpuinfoCurrentFrequency
+		}
+		if freq == nil {
+			continue
+		}
+		sum += float64(*freq)
+		count++
+		if s.CpuinfoMinimumFrequency != nil && (minimum == 0 || float64(*s.CpuinfoMinimumFrequency) < minimum) {
+			minimum = float64(*s.CpuinfoMinimumFrequency)
+		}
+		if s.CpuinfoMaximumFrequency != nil && float64(*s.CpuinfoMaximumFrequency) > maximum {
+			maximum = float64(*s.CpuinfoMaximumFrequency)
+		}
+	}
+	if count == 0 {
+		return 0, 0, 0, errors.New("no cpu frequency available")
+	}
+	// cpufreq reports kHz
+	return math.Round(sum/float64(count)) / 1000, minimum / 1000, maximum / 1000, nil
+}
+
+func newCPU(probe *cpuProbe, property string, sensor Sensor) *CPU {
+	sensor.UniqueID = property
+	sensor.Type = "sensor"
+	sensor.StateClass = "measurement"
+	sensor.EntityCategory = "diagnostic"
+	return &CPU{
+		Sensor:   sensor,
+		probe:    probe,
+		property: property,
+		interval: 30 * time.Second,
+	}
+}
+
+// DiscoverCPU creates the CPU usage, frequency and process sensors. The
+// frequency sensor is left out when cpufreq isn't available, like on most
+// virtual machines.
+func DiscoverCPU() ([]*CPU, error) {
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+	sys, err := sysfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+	probe := &cpuProbe{fs: fs, sys: sys}
+
+	cpus := []*CPU{
+		newCPU(probe, cpuUsage, Sensor{
+			Name:              "CPU usage",
+			Icon:              "mdi:cpu-64-bit",
+			UnitOfMeasurement: "%",
+		}),
+	}
+	if _, _, _, err := cpuFrequencies(sys); err == nil {
+		cpus = append(cpus, newCPU(probe, cpuFrequency, Sensor{
+			Name:              "CPU frequency",
+			Icon:              "mdi:speedometer",
+			DeviceClass:       "frequency",
+			UnitOfMeasurement: "MHz",
+		}))
+	}
+	cpus = append(cpus,
+		newCPU(probe, cpuProcessesRunning, Sensor{
+			Name: "Processes running",
+			Icon: "mdi:application-cog",
+		}),
+		newCPU(probe, cpuProcessesBlocked, Sensor{
+			Name: "Processes blocked",
+			Icon: "mdi:application-cog-outline",
+		}),
+	)
+
+	for _, c := range cpus {
+		err := c.Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cpus, nil
+}
@@ -0,0 +1,326 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/procfs"
+	"github.com/prometheus/procfs/blockdevice"
+)
+
+// Filesystems that are backed by a device but aren't interesting to report,
+// like the read-only images of snaps.
+var ignoredFilesystems = map[string]bool{
+	"squashfs": true,
+	"iso9660":  true,
+}
+
+// Filesystems that aren't backed by a device in /dev but hold real data.
+var deviceLessFilesystems = map[string]bool{
+	"zfs":  true,
+	"nfs":  true,
+	"nfs4": true,
+	"cifs": true,
+	"smb3": true,
+}
+
+// statfsTimeout is how long to wait for the usage of a filesystem. Network
+// filesystems hang when their server is gone.
+const statfsTimeout = 5 * time.Second
+
+// Disk reports the usage of a mounted filesystem.
+type Disk struct {
+	Sensor
+	Mount    *procfs.MountInfo
+	interval time.Duration
+	// hung is closed when a Statfs that timed out returns after all
+	hung chan struct{}
+}
+
+func (d *Disk) GetSensors() []*Sensor {
+	return []*Sensor{&d.Sensor}
+}
+
+func (d *Disk) Enable() {
+	d.Sensor.Disabled = false
+}
+
+func (d *Disk) Disable() {
+	d.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (d *Disk) Interval() time.Duration {
+	return d.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (d *Disk) SetInterval(interval time.Duration) {
+	d.interval = interval
+}
+
+func (d *Disk) Update() error {
+	stat, err := d.statfs()
+	if err != nil {
+		return err
+	}
+	total := stat.Blocks * uint64(stat.Bsize)
+	free := stat.Bavail * uint64(stat.Bsize)
+	// Like df, blocks reserved for root count as used.
+	used := total - stat.Bfree*uint64(stat.Bsize)
+	if used+free == 0 {
+		return errors.New("filesystem has no size")
+	}
+
+	d.State = math.Round(float64(used)/float64(used+free)*10000) / 100
+	d.Attributes = map[string]any{
+		"free":        free,
+		"total":       total,
+		"used":        used,
+		"mount_point": d.Mount.MountPoint,
+		"filesystem":  d.Mount.FSType,
+		"device":      d.Mount.Source,
+	}
+	return nil
+}
+
+// statfs returns the usage of the filesystem, giving up after statfsTimeout
+// so a hung filesystem doesn't block the collector. Until the Statfs that
+// hung returns, no new one is tried.
+func (d *Disk) statfs() (*syscall.Statfs_t, error) {
+	if d.hung != nil {
+		select {
+		case <-d.hung:
+			d.hung = nil
+		default:
+			return nil, errors.New("filesystem still not responding")
+		}
+	}
+
+	done := make(chan struct{})
+	var stat syscall.Statfs_t
+	var err error
+	go func() {
+		err = syscall.Statfs(d.Mount.MountPoint, &stat)
+		close(done)
+	}()
+	select {
+	case <-done:
+		if err != nil {
+			return nil, err
+		}
+		return &stat, nil
+	case <-time.After(statfsTimeout):
+		d.hung = done
+		return nil, fmt.Errorf("filesystem didn't respond within %v", statfsTimeout)
+	}
+}
+
+// DiskIO reports the read or write throughput of a block device.
+type DiskIO struct {
+	Sensor
+	fs       blockdevice.FS
+	device   string
+	write    bool
+	previous uint64
+	sampled  time.Time
+	interval time.Duration
+}
+
+func (d *DiskIO) GetSensors() []*Sensor {
+	return []*Sensor{&d.Sensor}
+}
+
+func (d *DiskIO) Enable() {
+	d.Sensor.Disabled = false
+}
+
+func (d *DiskIO) Disable() {
+	d.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (d *DiskIO) Interval() time.Duration {
+	return d.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (d *DiskIO) SetInterval(interval time.Duration) {
+	d.interval = interval
+}
+
+// Update computes the throughput since the previous update.
+func (d *DiskIO) Update() error {
+	stats, err := d.fs.ProcDiskstats()
+	if err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if s.DeviceName != d.device {
+			continue
+		}
+		sectors := s.ReadSectors
+		if d.write {
+			sectors = s.WriteSectors
+		}
+		// diskstats always counts 512 byte sectors
+		bytes := sectors * 512
+		now := time.Now()
+		if !d.sampled.IsZero() && bytes >= d.previous {
+			elapsed := now.Sub(d.sampled).Seconds()
+			if elapsed > 0 {
+				d.State = math.Round(float64(bytes-d.previous)/elapsed/1000*10) / 10
+			}
+		} else {
+			d.State = 0
+		}
+		d.previous = bytes
+		d.sampled = now
+		d.Attributes = map[string]any{
+			"total": bytes,
+		}
+		return nil
+	}
+	return fmt.Errorf("device %s not found in diskstats", d.device)
+}
+
+// isRealFilesystem tells filesystems holding data apart from pseudo
+// filesystems like proc, sysfs or tmpfs.
+func isRealFilesystem(m *procfs.MountInfo) bool {
+	if ignoredFilesystems[m.FSType] {
+		return false
+	}
+	return strings.HasPrefix(m.Source, "/dev/") || deviceLessFilesystems[m.FSType]
+}
+
+// matchPattern reports whether name, like a mount point or an interface,
+// matches one of the glob patterns.
+func matchPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mountID turns a mount point into part of a unique ID.
+func mountID(mountPoint string) string {
+	if mountPoint == "/" {
+		return "root"
+	}
+	return slug(mountPoint)
+}
+
+// DiscoverDisks creates usage sensors for the real filesystems of
+// /proc/self/mountinfo, and read and write throughput sensors for the block
+// devices they are on. When include is set, only mount points matching one
+// of its glob patterns are used. Mount points matching exclude are skipped.
+// It returns none, without an error, when no filesystem is left.
+func DiscoverDisks(include, exclude []string) ([]SensorInterface, error) {
+	mounts, err := procfs.GetMounts()
+	if err != nil {
+		return nil, err
+	}
+	block, err := blockdevice.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+	stats, err := block.ProcDiskstats()
+	if err != nil {
+		return nil, err
+	}
+	devices := map[string]string{}
+	for _, s := range stats {
+		devices[fmt.Sprintf("%d:%d", s.MajorNumber, s.MinorNumber)] = s.DeviceName
+	}
+
+	// Shortest mount points first, so bind mounts and subvolumes of a
+	// filesystem are reported once, by its topmost mount.
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].MountPoint) < len(mounts[j].MountPoint)
+	})
+
+	found := []SensorInterface{}
+	seenMounts := map[string]bool{}
+	seenDevices := map[string]bool{}
+	for _, m := range mounts {
+		if !isRealFilesystem(m) || seenMounts[m.MajorMinorVer] {
+			continue
+		}
+		if len(include) > 0 && !matchPattern(include, m.MountPoint) {
+			continue
+		}
+		if matchPattern(exclude, m.MountPoint) {
+			continue
+		}
+		seenMounts[m.MajorMinorVer] = true
+
+		disk := &Disk{
+			Sensor: Sensor{
+				Name:              "Disk usage " + m.MountPoint,
+				UniqueID:          "disk_usage_" + mountID(m.MountPoint),
+				Type:              "sensor",
+				Icon:              "mdi:harddisk",
+				UnitOfMeasurement: "%",
+				StateClass:        "measurement",
+				EntityCategory:    "diagnostic",
+			},
+			Mount:    m,
+			interval: 60 * time.Second,
+		}
+		if err := disk.Update(); err != nil {
+			continue
+		}
+		found = append(found, disk)
+
+		// btrfs and others use anonymous device numbers, so fall back to
+		// the name of the source device.
+		device, ok := devices[m.MajorMinorVer]
+		if !ok {
+			device = filepath.Base(m.Source)
+		}
+		if seenDevices[device] {
+			continue
+		}
+		for _, write := range []bool{false, true} {
+			direction, icon := "read", "mdi:harddisk-plus"
+			if write {
+				direction, icon = "write", "mdi:harddisk-remove"
+			}
+			io := &DiskIO{
+				Sensor: Sensor{
+					Name:              fmt.Sprintf("Disk %s %s", direction, device),
+					UniqueID:          fmt.Sprintf("disk_%s_%s", direction, slug(device)),
+					Type:              "sensor",
+					Icon:              icon,
+					DeviceClass:       "data_rate",
+					UnitOfMeasurement: "kB/s",
+					StateClass:        "measurement",
+					EntityCategory:    "diagnostic",
+				},
+				fs:       block,
+				device:   device,
+				write:    write,
+				interval: 30 * time.Second,
+			}
+			if err := io.Update(); err != nil {
+				break
+			}
+			seenDevices[device] = true
+			found = append(found, io)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
@@ -0,0 +1,190 @@
+package sensors
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/host"
+)
+
+// Values reported by the host sensors.
+const (
+	hostLastBoot     = "last_boot"
+	hostUptime       = "uptime"
+	hostKernel       = "kernel_version"
+	hostDistribution = "distribution"
+	hostSessions     = "sessions"
+)
+
+// Host reports information about the machine and its operating system.
+type Host struct {
+	Sensor
+	property string
+	interval time.Duration
+}
+
+func (h *Host) GetSensors() []*Sensor {
+	return []*Sensor{&h.Sensor}
+}
+
+func (h *Host) Enable() {
+	h.Sensor.Disabled = false
+}
+
+func (h *Host) Disable() {
+	h.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (h *Host) Interval() time.Duration {
+	return h.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (h *Host) SetInterval(interval time.Duration) {
+	h.interval = interval
+}
+
+func (h *Host) Update() error {
+	switch h.property {
+	case hostLastBoot:
+		boot, err := host.BootTime()
+		if err != nil {
+			return err
+		}
+		h.State = time.Unix(int64(boot), 0).Format(time.RFC3339)
+	case hostUptime:
+		uptime, err := host.Uptime()
+		if err != nil {
+			return err
+		}
+		h.State = math.Round(float64(uptime)/60/60*100) / 100
+	case hostKernel:
+		kernel, err := host.KernelVersion()
+		if err != nil {
+			return err
+		}
+		arch, _ := host.KernelArch()
+		h.State = kernel
+		h.Attributes = map[string]any{
+			"architecture": arch,
+		}
+	case hostDistribution:
+		release, err := readOSRelease("/etc/os-release")
+		if err != nil {
+			release, err = readOSRelease("/usr/lib/os-release")
+		}
+		if err != nil {
+			return err
+		}
+		h.State = release["NAME"]
+		h.Attributes = map[string]any{
+			"id":          release["ID"],
+			"version":     release["VERSION"],
+			"version_id":  release["VERSION_ID"],
+			"pretty_name": release["PRETTY_NAME"],
+		}
+	case hostSessions:
+		users, err := host.Users()
+		if err != nil {
+			return err
+		}
+		names := []string{}
+		seen := map[string]bool{}
+		for _, u := range users {
+			if !seen[u.User] {
+				seen[u.User] = true
+				names = append(names, u.User)
+			}
+		}
+		sort.Strings(names)
+		h.State = len(users)
+		h.Attributes = map[string]any{
+			"users": names,
+		}
+	}
+	return nil
+}
+
+// readOSRelease parses an os-release file into its variables.
+func readOSRelease(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	release := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		release[key] = strings.Trim(value, `"'`)
+	}
+	return release, scanner.Err()
+}
+
+func newHost(property string, interval time.Duration, sensor Sensor) *Host {
+	sensor.UniqueID = property
+	sensor.Type = "sensor"
+	sensor.EntityCategory = "diagnostic"
+	return &Host{
+		Sensor:   sensor,
+		property: property,
+		interval: interval,
+	}
+}
+
+// DiscoverHost creates the boot time, uptime, kernel, distribution and
+// session sensors. Sensors that can't be read on this system are left out.
+func DiscoverHost() ([]*Host, error) {
+	candidates := []*Host{
+		newHost(hostLastBoot, time.Hour, Sensor{
+			Name:        "Last boot",
+			Icon:        "mdi:restart",
+			DeviceClass: "timestamp",
+		}),
+		newHost(hostUptime, 5*time.Minute, Sensor{
+			Name:              "Uptime",
+			Icon:              "mdi:timer-outline",
+			DeviceClass:       "duration",
+			UnitOfMeasurement: "h",
+			StateClass:        "measurement",
+		}),
+		newHost(hostKernel, time.Hour, Sensor{
+			Name: "Kernel version",
+			Icon: "mdi:linux",
+		}),
+		newHost(hostDistribution, time.Hour, Sensor{
+			Name: "Distribution",
+			Icon: "mdi:package-variant",
+		}),
+		newHost(hostSessions, time.Minute, Sensor{
+			Name:       "Sessions",
+			Icon:       "mdi:account-multiple",
+			StateClass: "measurement",
+		}),
+	}
+
+	found := []*Host{}
+	for _, h := range candidates {
+		if err := h.Update(); err == nil {
+			found = append(found, h)
+		}
+	}
+	if len(found) == 0 {
+		return nil, errors.New("no host information available")
+	}
+	return found, nil
+}
@@ -0,0 +1,240 @@
+package sensors
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Hardware is a temperature or fan sensor read from a single sysfs file,
+// from either /sys/class/hwmon or /sys/class/thermal.
+type Hardware struct {
+	Sensor
+	// File holding the raw value
+	path string
+	// Divider to convert the raw value to the unit of the sensor
+	scale    float64
+	interval time.Duration
+}
+
+func (h *Hardware) GetSensors() []*Sensor {
+	return []*Sensor{&h.Sensor}
+}
+
+func (h *Hardware) Enable() {
+	h.Sensor.Disabled = false
+}
+
+func (h *Hardware) Disable() {
+	h.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (h *Hardware) Interval() time.Duration {
+	return h.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (h *Hardware) SetInterval(interval time.Duration) {
+	h.interval = interval
+}
+
+func (h *Hardware) Update() error {
+	value, err := readSysfsInt(h.path)
+	if err != nil {
+		return err
+	}
+	h.State = math.Round(float64(value)/h.scale*10) / 10
+	return nil
+}
+
+func readSysfsInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+func readSysfsString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// slug turns a label into something usable in a unique ID.
+func slug(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(s))
+	for strings.Contains(s, "__") {
+		s = strings.ReplaceAll(s, "__", "_")
+	}
+	return strings.Trim(s, "_")
+}
+
+func newTemperature(path, id, name string) *Hardware {
+	return &Hardware{
+		Sensor: Sensor{
+			Name:              name,
+			UniqueID:          id,
+			Type:              "sensor",
+			Icon:              "mdi:thermometer",
+			DeviceClass:       "temperature",
+			UnitOfMeasurement: "°C",
+			StateClass:        "measurement",
+			EntityCategory:    "diagnostic",
+		},
+		path:     path,
+		scale:    1000,
+		interval: 30 * time.Second,
+	}
+}
+
+func newFan(path, id, name string) *Hardware {
+	return &Hardware{
+		Sensor: Sensor{
+			Name:              name,
+			UniqueID:          id,
+			Type:              "sensor",
+			Icon:              "mdi:fan",
+			UnitOfMeasurement: "RPM",
+			StateClass:        "measurement",
+			EntityCategory:    "diagnostic",
+		},
+		path:     path,
+		scale:    1,
+		interval: 30 * time.Second,
+	}
+}
+
+type hwmonChip struct {
+	dir    string
+	name   string
+	device string
+}
+
+// DiscoverHardware finds the temperature and fan sensors of /sys/class/hwmon
+// and the ACPI thermal zones of /sys/class/thermal. It returns none, without
+// an error, when there are none.
+func DiscoverHardware() ([]*Hardware, error) {
+	return discoverHardware("/sys")
+}
+
+func discoverHardware(sys string) ([]*Hardware, error) {
+	candidates := discoverHwmon(filepath.Join(sys, "class", "hwmon"))
+	candidates = append(candidates, discoverThermalZones(filepath.Join(sys, "class", "thermal"))...)
+	found := []*Hardware{}
+	for _, h := range candidates {
+		// Skip inputs that can't be read, like sensors of a sleeping drive
+		if err := h.Update(); err == nil {
+			found = append(found, h)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
+
+// discoverHwmon creates sensors for the temp*_input and fan*_input files of
+// each hwmon chip. The numbering of hwmon devices changes between boots, so
+// unique IDs are made of the chip name, the device it belongs to when more
+// chips share a name, and the label of the input.
+func discoverHwmon(dir string) []*Hardware {
+	paths, _ := filepath.Glob(filepath.Join(dir, "hwmon*"))
+	chips := []hwmonChip{}
+	names := map[string]int{}
+	for _, path := range paths {
+		name := readSysfsString(filepath.Join(path, "name"))
+		// ACPI thermal zones are reported by discoverThermalZones
+		if name == "" || name == "acpitz" {
+			continue
+		}
+		device := ""
+		if target, err := filepath.EvalSymlinks(filepath.Join(path, "device")); err == nil {
+			device = filepath.Base(target)
+		}
+		chips = append(chips, hwmonChip{dir: path, name: name, device: device})
+		names[name]++
+	}
+	sort.Slice(chips, func(i, j int) bool {
+		if chips[i].name != chips[j].name {
+			return chips[i].name < chips[j].name
+		}
+		return chips[i].device < chips[j].device
+	})
+
+	found := []*Hardware{}
+	for _, chip := range chips {
+		chipID := slug(chip.name)
+		chipName := chip.name
+		if names[chip.name] > 1 && chip.device != "" {
+			chipID += "_" + slug(chip.device)
+			chipName += " " + chip.device
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(chip.dir, "*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			base := strings.TrimSuffix(filepath.Base(input), "_input")
+			isTemp := strings.HasPrefix(base, "temp")
+			isFan := strings.HasPrefix(base, "fan")
+			if !isTemp && !isFan {
+				continue
+			}
+			label := readSysfsString(filepath.Join(chip.dir, base+"_label"))
+			id := chipID + "_" + base
+			name := chipName + " " + base
+			if label != "" {
+				id = chipID + "_" + slug(label)
+				name = chipName + " " + label
+			}
+
+			if isTemp {
+				found = append(found, newTemperature(input, "temperature_"+id, name))
+			} else {
+				found = append(found, newFan(input, "fan_"+id, name))
+			}
+		}
+	}
+	return found
+}
+
+// discoverThermalZones creates a temperature sensor for each thermal zone,
+// identified by its type.
+func discoverThermalZones(dir string) []*Hardware {
+	paths, _ := filepath.Glob(filepath.Join(dir, "thermal_zone*"))
+	sort.Strings(paths)
+	types := map[string]int{}
+	for _, path := range paths {
+		types[readSysfsString(filepath.Join(path, "type"))]++
+	}
+
+	found := []*Hardware{}
+	for _, path := range paths {
+		input := filepath.Join(path, "temp")
+		t := readSysfsString(filepath.Join(path, "type"))
+		if t == "" {
+			continue
+		}
+		id := "thermal_" + slug(t)
+		name := "Thermal zone " + t
+		if types[t] > 1 {
+			zone := strings.TrimPrefix(filepath.Base(path), "thermal_zone")
+			id += "_" + zone
+			name += " " + zone
+		}
+		found = append(found, newTemperature(input, id, name))
+	}
+	return found
+}
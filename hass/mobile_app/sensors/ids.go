@@ -0,0 +1,71 @@
+package sensors
+
+import "strings"
+
+// IDScheme builds the unique ID of a sensor from the namespace of its
+// family, like battery or command, and the ID the sensor reports.
+type IDScheme struct {
+	Version int
+	ID      func(namespace, id string) string
+}
+
+// idSchemes lists the unique ID schemes, oldest first. The last one is the
+// current one, the older ones give the IDs sensors were registered with by
+// earlier releases, so those can be migrated.
+var idSchemes = []IDScheme{
+	{
+		// The IDs as reported by the sensors, which can collide between
+		// families, like a command sensor with unique_id load.
+		Version: 1,
+		ID: func(namespace, id string) string {
+			return id
+		},
+	},
+	{
+		// IDs start with the namespace of their family.
+		Version: 2,
+		ID: func(namespace, id string) string {
+			if id == namespace || strings.HasPrefix(id, namespace+"_") {
+				return id
+			}
+			return namespace + "_" + id
+		},
+	},
+}
+
+// IDVersion is the version of the current unique ID scheme.
+var IDVersion = idSchemes[len(idSchemes)-1].Version
+
+// UniqueID returns the unique ID of a sensor in the current scheme.
+func UniqueID(namespace, id string) string {
+	return idSchemes[len(idSchemes)-1].ID(namespace, id)
+}
+
+// PreviousIDs returns the unique IDs a sensor had in the earlier schemes,
+// when they differ from its current one.
+func PreviousIDs(namespace, id string) []string {
+	current := UniqueID(namespace, id)
+	previous := []string{}
+	for _, scheme := range idSchemes[:len(idSchemes)-1] {
+		old := scheme.ID(namespace, id)
+		if old != current && !contains(previous, old) {
+			previous = append(previous, old)
+		}
+	}
+	return previous
+}
+
+// IsLegacyID reports whether id is one of the unique IDs registered by the
+// releases that didn't keep track of the registered sensors: the load, the
+// memory usage and the level and state of the batteries.
+func IsLegacyID(namespace, id string) bool {
+	switch namespace {
+	case "load":
+		return id == "load"
+	case "memory":
+		return id == "memory_usage"
+	case "battery":
+		return strings.HasSuffix(id, "_level") || strings.HasSuffix(id, "_state")
+	}
+	return false
+}
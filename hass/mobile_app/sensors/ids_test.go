@@ -0,0 +1,67 @@
+package sensors
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueID(t *testing.T) {
+	tests := []struct {
+		namespace, id, want string
+	}{
+		{"load", "load", "load"},
+		{"memory", "memory_usage", "memory_usage"},
+		{"battery", "BAT0_level", "battery_BAT0_level"},
+		{"battery", "battery_BAT0_level", "battery_BAT0_level"},
+		{"command", "load", "command_load"},
+		{"command", "command_uptime", "command_uptime"},
+		// The namespace has to be a whole word
+		{"disk", "diskio_sda_read", "disk_diskio_sda_read"},
+		{"network", "networkmanager", "network_networkmanager"},
+		{"cpu", "cpu", "cpu"},
+	}
+	for _, tt := range tests {
+		if got := UniqueID(tt.namespace, tt.id); got != tt.want {
+			t.Errorf("UniqueID(%q, %q) = %q, want %q", tt.namespace, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestIsLegacyID(t *testing.T) {
+	tests := []struct {
+		namespace, id string
+		want          bool
+	}{
+		{"load", "load", true},
+		{"memory", "memory_usage", true},
+		{"memory", "memory_available", false},
+		{"battery", "BAT0_level", true},
+		{"battery", "BAT0_state", true},
+		{"battery", "BAT0_health", false},
+		{"command", "load", false},
+		{"cpu", "cpu_usage", false},
+	}
+	for _, tt := range tests {
+		if got := IsLegacyID(tt.namespace, tt.id); got != tt.want {
+			t.Errorf("IsLegacyID(%q, %q) = %v, want %v", tt.namespace, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestPreviousIDs(t *testing.T) {
+	tests := []struct {
+		namespace, id string
+		want          []string
+	}{
+		{"load", "load", []string{}},
+		{"memory", "memory_usage", []string{}},
+		{"battery", "BAT0_level", []string{"BAT0_level"}},
+		{"command", "load", []string{"load"}},
+		{"disk", "diskio_sda_read", []string{"diskio_sda_read"}},
+	}
+	for _, tt := range tests {
+		if got := PreviousIDs(tt.namespace, tt.id); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("PreviousIDs(%q, %q) = %q, want %q", tt.namespace, tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package sensors
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/subutux/hass_companion/internal/logger"
+)
+
+const (
+	logindDest        = "org.freedesktop.login1"
+	logindPath        = "/org/freedesktop/login1"
+	logindManager     = "org.freedesktop.login1.Manager"
+	logindSession     = "org.freedesktop.login1.Session"
+	logindSeat        = "org.freedesktop.login1.Seat"
+	logindDefaultSeat = "/org/freedesktop/login1/seat/seat0"
+)
+
+// Values reported by the logind sensors.
+const (
+	logindLocked            = "screen_locked"
+	logindIdle              = "session_idle"
+	logindActiveUser        = "active_user"
+	logindPreparingSleep    = "preparing_for_sleep"
+	logindPreparingShutdown = "preparing_for_shutdown"
+)
+
+// Session reports the state of the login session the companion runs in, the
+// user of the active session and whether the system is about to sleep or
+// shut down, from systemd-logind.
+type Session struct {
+	Sensor
+	conn     *dbus.Conn
+	session  dbus.ObjectPath
+	property string
+	// send sends a change of the sensor right away, see SensorSender
+	send func(change func())
+}
+
+func (s *Session) GetSensors() []*Sensor {
+	return []*Sensor{&s.Sensor}
+}
+
+func (s *Session) Enable() {
+	s.Sensor.Disabled = false
+}
+
+func (s *Session) Disable() {
+	s.Sensor.Disabled = true
+}
+
+// SetSend lets the sleep and shutdown sensors report the system going down
+// before logind carries on.
+func (s *Session) SetSend(send func(change func())) {
+	s.send = send
+}
+
+func (s *Session) Update() error {
+	switch s.property {
+	case logindLocked:
+		locked, err := s.conn.Object(logindDest, s.session).GetProperty(logindSession + ".LockedHint")
+		if err != nil {
+			return err
+		}
+		s.State, _ = locked.Value().(bool)
+	case logindIdle:
+		o := s.conn.Object(logindDest, s.session)
+		idle, err := o.GetProperty(logindSession + ".IdleHint")
+		if err != nil {
+			return err
+		}
+		isIdle, _ := idle.Value().(bool)
+		s.State = isIdle
+		s.Attributes = nil
+		if since, err := o.GetProperty(logindSession + ".IdleSinceHint"); err == nil {
+			if usec, _ := since.Value().(uint64); usec > 0 && isIdle {
+				s.Attributes = map[string]any{
+					"idle_since": time.UnixMicro(int64(usec)).Format(time.RFC3339),
+				}
+			}
+		}
+	case logindActiveUser:
+		id, path, err := activeSession(s.conn)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			s.State = StateUnavailable
+			s.Attributes = nil
+			return nil
+		}
+		o := s.conn.Object(logindDest, path)
+		s.State = stringProperty(o, logindSession+".Name")
+		s.Attributes = map[string]any{
+			"session": id,
+			"type":    stringProperty(o, logindSession+".Type"),
+		}
+	case logindPreparingSleep, logindPreparingShutdown:
+		property := ".PreparingForSleep"
+		if s.property == logindPreparingShutdown {
+			property = ".PreparingForShutdown"
+		}
+		preparing, err := s.conn.Object(logindDest, logindPath).GetProperty(logindManager + property)
+		if err != nil {
+			return err
+		}
+		s.State, _ = preparing.Value().(bool)
+	}
+	return nil
+}
+
+// Watch follows the logind signals this sensor depends on and calls notify
+// when they fire. The sleep and shutdown sensors hold a delay inhibitor lock,
+// so they are sent before the system goes down. The lock is released once
+// they were sent, and taken again after resuming.
+func (s *Session) Watch(notify func(), stop <-chan struct{}) error {
+	var options []dbus.MatchOption
+	var path dbus.ObjectPath
+	var name, iface, property string
+	switch s.property {
+	case logindLocked, logindIdle:
+		path, iface = s.session, logindSession
+		property = "LockedHint"
+		if s.property == logindIdle {
+			property = "IdleHint"
+		}
+	case logindActiveUser:
+		path, iface, property = logindDefaultSeat, logindSeat, "ActiveSession"
+	case logindPreparingSleep:
+		path, name = logindPath, logindManager+".PrepareForSleep"
+		options = []dbus.MatchOption{
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface(logindManager),
+			dbus.WithMatchMember("PrepareForSleep"),
+		}
+	case logindPreparingShutdown:
+		path, name = logindPath, logindManager+".PrepareForShutdown"
+		options = []dbus.MatchOption{
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface(logindManager),
+			dbus.WithMatchMember("PrepareForShutdown"),
+		}
+	}
+	if options == nil {
+		name = "org.freedesktop.DBus.Properties.PropertiesChanged"
+		options = []dbus.MatchOption{
+			dbus.WithMatchObjectPath(path),
+			dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+			dbus.WithMatchMember("PropertiesChanged"),
+		}
+	}
+
+	err := s.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer s.conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	s.conn.Signal(c)
+	defer s.conn.RemoveSignal(c)
+
+	var inhibitor *os.File
+	if property == "" && s.send != nil {
+		inhibitor = s.inhibit()
+		defer func() {
+			if inhibitor != nil {
+				inhibitor.Close()
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Path != path || v.Name != name {
+				continue
+			}
+			if property == "" {
+				if len(v.Body) < 1 {
+					continue
+				}
+				preparing, ok := v.Body[0].(bool)
+				if !ok {
+					continue
+				}
+				if s.send == nil {
+					notify()
+					continue
+				}
+				s.send(func() {
+					s.State = preparing
+				})
+				if preparing && inhibitor != nil {
+					inhibitor.Close()
+					inhibitor = nil
+				} else if !preparing && inhibitor == nil {
+					inhibitor = s.inhibit()
+				}
+				continue
+			}
+			if len(v.Body) < 3 {
+				continue
+			}
+			if changedIface, _ := v.Body[0].(string); changedIface != iface {
+				continue
+			}
+			changed, _ := v.Body[1].(map[string]dbus.Variant)
+			invalidated, _ := v.Body[2].([]string)
+			if _, ok := changed[property]; ok || contains(invalidated, property) {
+				notify()
+			}
+		}
+	}
+}
+
+// inhibit takes a delay inhibitor lock on sleep or shutdown, which holds
+// them off until the lock is released or logind stops waiting, after
+// InhibitDelayMaxSec. It returns nil when no lock could be taken.
+func (s *Session) inhibit() *os.File {
+	what := "sleep"
+	if s.property == logindPreparingShutdown {
+		what = "shutdown"
+	}
+	var fd dbus.UnixFD
+	err := s.conn.Object(logindDest, logindPath).
+		Call(logindManager+".Inhibit", 0, what, "HASS Companion", "Report the "+what+" to Home Assistant", "delay").
+		Store(&fd)
+	if err != nil {
+		logger.I().Warn("Unable to delay "+what, "error", err)
+		return nil
+	}
+	return os.NewFile(uintptr(fd), "logind-inhibitor")
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// findSession returns the logind session of the companion, or the active
+// session of the default seat when it runs outside of a session, like as a
+// systemd user service.
+func findSession(conn *dbus.Conn) (dbus.ObjectPath, error) {
+	var path dbus.ObjectPath
+	err := conn.Object(logindDest, logindPath).
+		Call(logindManager+".GetSessionByPID", 0, uint32(os.Getpid())).
+		Store(&path)
+	if err == nil {
+		return path, nil
+	}
+	if id := os.Getenv("XDG_SESSION_ID"); id != "" {
+		err = conn.Object(logindDest, logindPath).
+			Call(logindManager+".GetSession", 0, id).
+			Store(&path)
+		if err == nil {
+			return path, nil
+		}
+	}
+
+	_, path, err = activeSession(conn)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", errors.New("no logind session found")
+	}
+	return path, nil
+}
+
+// activeSession returns the ID and path of the active session of the default
+// seat. The path is empty when nobody is logged in on it.
+func activeSession(conn *dbus.Conn) (string, dbus.ObjectPath, error) {
+	active, err := conn.Object(logindDest, logindDefaultSeat).GetProperty(logindSeat + ".ActiveSession")
+	if err != nil {
+		return "", "", err
+	}
+	// ActiveSession is a (so) struct of the session ID and path
+	var session struct {
+		ID   string
+		Path dbus.ObjectPath
+	}
+	if err := dbus.Store([]any{active.Value()}, &session); err != nil {
+		return "", "", err
+	}
+	if session.Path == "/" {
+		return "", "", nil
+	}
+	return session.ID, session.Path, nil
+}
+
+func newSession(conn *dbus.Conn, session dbus.ObjectPath, property string, sensor Sensor) *Session {
+	sensor.UniqueID = property
+	if sensor.Type == "" {
+		sensor.Type = "binary_sensor"
+	}
+	return &Session{
+		Sensor:   sensor,
+		conn:     conn,
+		session:  session,
+		property: property,
+	}
+}
+
+// DiscoverSession creates the logind sensors when systemd-logind is
+// available on the system bus. The screen locked and idle sensors are left
+// out when no session can be found.
+func DiscoverSession(systemdbus *dbus.Conn) ([]*Session, error) {
+	_, err := systemdbus.Object(logindDest, logindPath).GetProperty(logindManager + ".IdleHint")
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*Session{}
+	if session, err := findSession(systemdbus); err == nil {
+		candidates = append(candidates,
+			newSession(systemdbus, session, logindLocked, Sensor{
+				Name: "Screen locked",
+				Icon: "mdi:monitor-lock",
+			}),
+			newSession(systemdbus, session, logindIdle, Sensor{
+				Name: "Session idle",
+				Icon: "mdi:sleep",
+			}),
+		)
+	}
+	candidates = append(candidates,
+		newSession(systemdbus, "", logindActiveUser, Sensor{
+			Name: "Active user",
+			Icon: "mdi:account",
+			Type: "sensor",
+		}),
+		newSession(systemdbus, "", logindPreparingSleep, Sensor{
+			Name: "Preparing for sleep",
+			Icon: "mdi:power-sleep",
+		}),
+		newSession(systemdbus, "", logindPreparingShutdown, Sensor{
+			Name: "Preparing for shutdown",
+			Icon: "mdi:power",
+		}),
+	)
+
+	found := []*Session{}
+	for _, s := range candidates {
+		if err := s.Update(); err == nil {
+			found = append(found, s)
+		}
+	}
+	if len(found) == 0 {
+		return nil, errors.New("no logind sensors available")
+	}
+	return found, nil
+}
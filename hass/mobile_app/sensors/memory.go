@@ -1,17 +1,30 @@
 package sensors
 
 import (
+	"errors"
 	"math"
+	"time"
 
 	"github.com/prometheus/procfs"
 )
 
+// Values reported by the memory sensors.
+const (
+	memoryUsage     = "memory_usage"
+	memoryAvailable = "memory_available"
+	swapUsage       = "swap_usage"
+	swapUsed        = "swap_used"
+	memoryPressure  = "memory_pressure"
+)
+
 type Memory struct {
 	Sensor
+	fs       procfs.FS
+	property string
+	interval time.Duration
 }
 
 func (a *Memory) GetSensors() []*Sensor {
-	a.Update()
 	return []*Sensor{&a.Sensor}
 }
 
@@ -23,44 +36,162 @@ func (a *Memory) Disable() {
 	a.Sensor.Disabled = true
 }
 
+// Interval returns how often the sensor is polled.
+func (a *Memory) Interval() time.Duration {
+	return a.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (a *Memory) SetInterval(interval time.Duration) {
+	a.interval = interval
+}
+
 func (a *Memory) Update() (err error) {
-	fs, err := procfs.NewDefaultFS()
+	if a.property == memoryPressure {
+		return a.updatePressure()
+	}
 
+	mem, err := a.fs.Meminfo()
 	if err != nil {
 		return err
 	}
 
-	mem, err := fs.Meminfo()
+	switch a.property {
+	case memoryUsage, memoryAvailable:
+		if mem.MemTotal == nil || mem.MemAvailable == nil {
+			return errors.New("meminfo has no MemTotal or MemAvailable")
+		}
+		// meminfo reports kB
+		total := *mem.MemTotal * 1024
+		available := *mem.MemAvailable * 1024
+		used := total - available
+		if a.property == memoryUsage {
+			a.State = percentage(used, total)
+		} else {
+			a.State = available
+		}
+		a.Attributes = map[string]any{
+			"total":     total,
+			"available": available,
+			"used":      used,
+		}
+		if mem.MemFree != nil {
+			a.Attributes["free"] = *mem.MemFree * 1024
+		}
+	case swapUsage, swapUsed:
+		if mem.SwapTotal == nil || mem.SwapFree == nil {
+			return errors.New("meminfo has no SwapTotal or SwapFree")
+		}
+		total := *mem.SwapTotal * 1024
+		free := *mem.SwapFree * 1024
+		used := total - free
+		if a.property == swapUsage {
+			a.State = percentage(used, total)
+		} else {
+			a.State = used
+		}
+		a.Attributes = map[string]any{
+			"total": total,
+			"free":  free,
+			"used":  used,
+		}
+	}
+	return nil
+}
+
+// updatePressure reports the share of time some tasks were stalled waiting
+// for memory during the last 10 seconds.
+func (a *Memory) updatePressure() error {
+	psi, err := a.fs.PSIStatsForResource("memory")
 	if err != nil {
 		return err
 	}
-	percentage := float64(*mem.MemTotal) / float64(*mem.MemFree)
-	a.State = math.Ceil(percentage*100) / 100
+	if psi.Some == nil {
+		return errors.New("no memory pressure available")
+	}
+	a.State = psi.Some.Avg10
 	a.Attributes = map[string]any{
-		"free":      mem.MemFree,
-		"total":     mem.MemTotal,
-		"available": mem.MemAvailable,
+		"some_avg60":  psi.Some.Avg60,
+		"some_avg300": psi.Some.Avg300,
+	}
+	if psi.Full != nil {
+		a.Attributes["full_avg10"] = psi.Full.Avg10
+		a.Attributes["full_avg60"] = psi.Full.Avg60
+		a.Attributes["full_avg300"] = psi.Full.Avg300
 	}
 	return nil
 }
 
-func DiscoverMemory() (*Memory, error) {
+// percentage returns part of total in percent, rounded to two decimals.
+func percentage(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 100
+}
+
+func newMemory(fs procfs.FS, property string, sensor Sensor) *Memory {
+	sensor.UniqueID = property
+	sensor.Type = "sensor"
+	sensor.StateClass = "measurement"
+	sensor.EntityCategory = "diagnostic"
+	return &Memory{
+		Sensor:   sensor,
+		fs:       fs,
+		property: property,
+		interval: 30 * time.Second,
+	}
+}
 
-	sensor := Memory{
-		Sensor{
+// DiscoverMemory creates the memory and swap usage sensors, and the memory
+// pressure sensor when the kernel supports PSI.
+func DiscoverMemory() ([]*Memory, error) {
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+	return discoverMemory(fs)
+}
+
+func discoverMemory(fs procfs.FS) ([]*Memory, error) {
+	candidates := []*Memory{
+		newMemory(fs, memoryUsage, Sensor{
+			Name:              "Memory usage",
+			Icon:              "mdi:memory",
 			UnitOfMeasurement: "%",
+		}),
+		newMemory(fs, memoryAvailable, Sensor{
+			Name:              "Memory available",
 			Icon:              "mdi:memory",
-			Name:              "memory Usage",
-			UniqueID:          "memory_usage",
-			Type:              "sensor",
-			EntityCategory:    "diagnostic",
-			Disabled:          false,
-		},
+			DeviceClass:       "data_size",
+			UnitOfMeasurement: "B",
+		}),
+		newMemory(fs, swapUsage, Sensor{
+			Name:              "Swap usage",
+			Icon:              "mdi:harddisk",
+			UnitOfMeasurement: "%",
+		}),
+		newMemory(fs, swapUsed, Sensor{
+			Name:              "Swap used",
+			Icon:              "mdi:harddisk",
+			DeviceClass:       "data_size",
+			UnitOfMeasurement: "B",
+		}),
+		newMemory(fs, memoryPressure, Sensor{
+			Name:              "Memory pressure",
+			Icon:              "mdi:gauge",
+			UnitOfMeasurement: "%",
+		}),
 	}
 
-	err := sensor.Update()
-	if err != nil {
-		return nil, err
+	found := []*Memory{}
+	for _, m := range candidates {
+		err := m.Update()
+		if err == nil {
+			found = append(found, m)
+		} else if m.property == memoryUsage {
+			return nil, err
+		}
 	}
-	return &sensor, nil
+	return found, nil
 }
@@ -0,0 +1,174 @@
+package sensors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/procfs"
+)
+
+const testMeminfo = `MemTotal:        8000000 kB
+MemFree:         1000000 kB
+MemAvailable:    6000000 kB
+SwapTotal:       2000000 kB
+SwapFree:        1500000 kB
+`
+
+const testMeminfoNoSwap = `MemTotal:        8000000 kB
+MemFree:         1000000 kB
+MemAvailable:    6000000 kB
+SwapTotal:             0 kB
+SwapFree:              0 kB
+`
+
+const testPressure = `some avg10=1.50 avg60=0.75 avg300=0.25 total=12345
+full avg10=0.50 avg60=0.25 avg300=0.10 total=6789
+`
+
+// testProcFS writes the given files under a temporary /proc and returns it.
+func testProcFS(t *testing.T, files map[string]string) procfs.FS {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// memorySensors returns the discovered memory sensors by unique ID.
+func memorySensors(t *testing.T, fs procfs.FS) map[string]*Memory {
+	t.Helper()
+	found, err := discoverMemory(fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensors := map[string]*Memory{}
+	for _, m := range found {
+		sensors[m.UniqueID] = m
+	}
+	return sensors
+}
+
+func TestDiscoverMemory(t *testing.T) {
+	fs := testProcFS(t, map[string]string{
+		"meminfo":         testMeminfo,
+		"pressure/memory": testPressure,
+	})
+	sensors := memorySensors(t, fs)
+
+	tests := []struct {
+		id    string
+		state any
+		attrs map[string]any
+	}{
+		{
+			id:    memoryUsage,
+			state: 25.0,
+			attrs: map[string]any{
+				"total":     uint64(8000000 * 1024),
+				"available": uint64(6000000 * 1024),
+				"used":      uint64(2000000 * 1024),
+				"free":      uint64(1000000 * 1024),
+			},
+		},
+		{
+			id:    memoryAvailable,
+			state: uint64(6000000 * 1024),
+		},
+		{
+			id:    swapUsage,
+			state: 25.0,
+			attrs: map[string]any{
+				"total": uint64(2000000 * 1024),
+				"free":  uint64(1500000 * 1024),
+				"used":  uint64(500000 * 1024),
+			},
+		},
+		{
+			id:    swapUsed,
+			state: uint64(500000 * 1024),
+		},
+		{
+			id:    memoryPressure,
+			state: 1.5,
+			attrs: map[string]any{
+				"some_avg60":  0.75,
+				"some_avg300": 0.25,
+				"full_avg10":  0.5,
+				"full_avg60":  0.25,
+				"full_avg300": 0.1,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			m, ok := sensors[tt.id]
+			if !ok {
+				t.Fatalf("sensor %s not discovered", tt.id)
+			}
+			if m.State != tt.state {
+				t.Errorf("state = %v (%T), want %v (%T)", m.State, m.State, tt.state, tt.state)
+			}
+			for key, want := range tt.attrs {
+				if got := m.Attributes[key]; got != want {
+					t.Errorf("attribute %s = %v (%T), want %v (%T)", key, got, got, want, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscoverMemoryNoSwap(t *testing.T) {
+	fs := testProcFS(t, map[string]string{
+		"meminfo":         testMeminfoNoSwap,
+		"pressure/memory": testPressure,
+	})
+	sensors := memorySensors(t, fs)
+
+	usage, ok := sensors[swapUsage]
+	if !ok {
+		t.Fatal("swap usage not discovered")
+	}
+	if usage.State != 0.0 {
+		t.Errorf("swap usage = %v, want 0", usage.State)
+	}
+	used, ok := sensors[swapUsed]
+	if !ok {
+		t.Fatal("swap used not discovered")
+	}
+	if used.State != uint64(0) {
+		t.Errorf("swap used = %v, want 0", used.State)
+	}
+}
+
+func TestDiscoverMemoryNoPressure(t *testing.T) {
+	fs := testProcFS(t, map[string]string{
+		"meminfo": testMeminfo,
+	})
+	sensors := memorySensors(t, fs)
+
+	if _, ok := sensors[memoryPressure]; ok {
+		t.Error("memory pressure discovered without PSI")
+	}
+	if _, ok := sensors[memoryUsage]; !ok {
+		t.Error("memory usage not discovered")
+	}
+}
+
+func TestDiscoverMemoryNoMeminfo(t *testing.T) {
+	fs := testProcFS(t, map[string]string{})
+	if _, err := discoverMemory(fs); err == nil {
+		t.Error("discovered memory sensors without meminfo")
+	}
+}
@@ -0,0 +1,295 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	mprisPrefix = "org.mpris.MediaPlayer2."
+	mprisPath   = "/org/mpris/MediaPlayer2"
+	mprisRoot   = "org.mpris.MediaPlayer2"
+	mprisPlayer = "org.mpris.MediaPlayer2.Player"
+	mediaIdle   = "idle"
+)
+
+// MediaPlayer reports the playback status of the active MPRIS media player
+// on the session bus, with what it is playing as attributes.
+type MediaPlayer struct {
+	Sensor
+	conn *dbus.Conn
+}
+
+func (m *MediaPlayer) GetSensors() []*Sensor {
+	return []*Sensor{&m.Sensor}
+}
+
+func (m *MediaPlayer) Enable() {
+	m.Sensor.Disabled = false
+}
+
+func (m *MediaPlayer) Disable() {
+	m.Sensor.Disabled = true
+}
+
+func (m *MediaPlayer) Update() error {
+	name, err := activePlayer(m.conn)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		m.State = mediaIdle
+		m.Attributes = nil
+		return nil
+	}
+
+	o := m.conn.Object(name, mprisPath)
+	status := stringProperty(o, mprisPlayer+".PlaybackStatus")
+	m.State = strings.ToLower(status)
+	if m.State == "" {
+		m.State = mediaIdle
+	}
+
+	attributes := map[string]any{
+		"player": playerName(m.conn, name),
+	}
+	if metadata, err := o.GetProperty(mprisPlayer + ".Metadata"); err == nil {
+		values, _ := metadata.Value().(map[string]dbus.Variant)
+		if title, ok := values["xesam:title"].Value().(string); ok {
+			attributes["title"] = title
+		}
+		if artists, ok := values["xesam:artist"].Value().([]string); ok {
+			attributes["artist"] = strings.Join(artists, ", ")
+		}
+		if album, ok := values["xesam:album"].Value().(string); ok {
+			attributes["album"] = album
+		}
+		if length, ok := microseconds(values["mpris:length"]); ok {
+			attributes["duration"] = length
+		}
+	}
+	if position, err := o.GetProperty(mprisPlayer + ".Position"); err == nil {
+		if seconds, ok := microseconds(position); ok {
+			attributes["position"] = seconds
+		}
+	}
+	if volume, err := o.GetProperty(mprisPlayer + ".Volume"); err == nil {
+		if level, ok := volume.Value().(float64); ok {
+			attributes["volume"] = math.Round(level * 100)
+		}
+	}
+	m.Attributes = attributes
+	return nil
+}
+
+// Watch follows the players on the session bus and calls notify when one
+// starts, stops or changes what it is playing.
+func (m *MediaPlayer) Watch(notify func(), stop <-chan struct{}) error {
+	properties := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(mprisPath),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	owners := []dbus.MatchOption{
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg0Namespace(mprisRoot),
+	}
+	for _, options := range [][]dbus.MatchOption{properties, owners} {
+		err := m.conn.AddMatchSignal(options...)
+		if err != nil {
+			return err
+		}
+		defer m.conn.RemoveMatchSignal(options...)
+	}
+
+	c := make(chan *dbus.Signal, 10)
+	m.conn.Signal(c)
+	defer m.conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			switch v.Name {
+			case "org.freedesktop.DBus.NameOwnerChanged":
+				if len(v.Body) > 0 {
+					if name, _ := v.Body[0].(string); strings.HasPrefix(name, mprisPrefix) {
+						notify()
+					}
+				}
+			case "org.freedesktop.DBus.Properties.PropertiesChanged":
+				if v.Path != mprisPath || len(v.Body) < 2 {
+					continue
+				}
+				if iface, _ := v.Body[0].(string); iface == mprisPlayer {
+					notify()
+				}
+			}
+		}
+	}
+}
+
+// microseconds converts an MPRIS time in microseconds to whole seconds.
+func microseconds(v dbus.Variant) (int64, bool) {
+	switch usec := v.Value().(type) {
+	case int64:
+		return usec / 1000000, true
+	case uint64:
+		return int64(usec / 1000000), true
+	}
+	return 0, false
+}
+
+// players returns the bus names of the MPRIS players on the session bus.
+func players(conn *dbus.Conn) ([]string, error) {
+	var names []string
+	err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names)
+	if err != nil {
+		return nil, err
+	}
+	found := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, mprisPrefix) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
+
+// activePlayer returns the bus name of the player that is playing, else one
+// that is paused, else any player. It returns an empty name when there are
+// no players.
+func activePlayer(conn *dbus.Conn) (string, error) {
+	names, err := players(conn)
+	if err != nil {
+		return "", err
+	}
+	best, bestRank := "", -1
+	for _, name := range names {
+		rank := 0
+		switch stringProperty(conn.Object(name, mprisPath), mprisPlayer+".PlaybackStatus") {
+		case "Playing":
+			rank = 2
+		case "Paused":
+			rank = 1
+		}
+		if rank > bestRank {
+			best, bestRank = name, rank
+		}
+	}
+	return best, nil
+}
+
+// playerName returns the name of a player as shown to the user, like
+// Spotify or Firefox.
+func playerName(conn *dbus.Conn, name string) string {
+	if identity := stringProperty(conn.Object(name, mprisPath), mprisRoot+".Identity"); identity != "" {
+		return identity
+	}
+	return strings.TrimPrefix(name, mprisPrefix)
+}
+
+// findPlayer returns the bus name of the player matching name, by its
+// identity or bus name, or the active player when name is empty.
+func findPlayer(conn *dbus.Conn, name string) (string, error) {
+	if name == "" {
+		player, err := activePlayer(conn)
+		if err == nil && player == "" {
+			err = errors.New("no media player running")
+		}
+		return player, err
+	}
+	names, err := players(conn)
+	if err != nil {
+		return "", err
+	}
+	for _, player := range names {
+		short := strings.TrimPrefix(player, mprisPrefix)
+		// Instances of a player are named like vlc.instance1234
+		short = strings.SplitN(short, ".", 2)[0]
+		if strings.EqualFold(short, name) || strings.EqualFold(playerName(conn, player), name) {
+			return player, nil
+		}
+	}
+	return "", fmt.Errorf("media player %s not found", name)
+}
+
+// ControlMedia sends a media command to a player. Player selects the player
+// by name, empty for the active one. The commands are play, pause,
+// play_pause, stop, next, previous, volume_up, volume_down and set_volume,
+// which sets the volume to value in percent.
+func ControlMedia(conn *dbus.Conn, player, command, value string) error {
+	name, err := findPlayer(conn, player)
+	if err != nil {
+		return err
+	}
+	o := conn.Object(name, mprisPath)
+
+	methods := map[string]string{
+		"play":       "Play",
+		"pause":      "Pause",
+		"play_pause": "PlayPause",
+		"stop":       "Stop",
+		"next":       "Next",
+		"previous":   "Previous",
+	}
+	if method, ok := methods[command]; ok {
+		return o.Call(mprisPlayer+"."+method, 0).Err
+	}
+
+	var volume float64
+	switch command {
+	case "volume_up", "volume_down":
+		current, err := o.GetProperty(mprisPlayer + ".Volume")
+		if err != nil {
+			return err
+		}
+		volume, _ = current.Value().(float64)
+		if command == "volume_up" {
+			volume += 0.1
+		} else {
+			volume -= 0.1
+		}
+	case "set_volume":
+		percent, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid volume %q", value)
+		}
+		volume = percent / 100
+	default:
+		return fmt.Errorf("unknown media command %q", command)
+	}
+	volume = math.Max(0, math.Min(1, volume))
+	return o.SetProperty(mprisPlayer+".Volume", dbus.MakeVariant(volume))
+}
+
+// DiscoverMediaPlayer creates the media player sensor when the session bus
+// is available.
+func DiscoverMediaPlayer(sessiondbus *dbus.Conn) (*MediaPlayer, error) {
+	media := &MediaPlayer{
+		Sensor: Sensor{
+			Name:     "Media player",
+			UniqueID: "media_player",
+			Type:     "sensor",
+			Icon:     "mdi:play-pause",
+		},
+		conn: sessiondbus,
+	}
+	err := media.Update()
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
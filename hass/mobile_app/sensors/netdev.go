@@ -0,0 +1,265 @@
+package sensors
+
+import (
+	"bufio"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/procfs"
+)
+
+// Values reported by the network traffic sensors.
+const (
+	trafficReceiveRate  = "rx_rate"
+	trafficTransmitRate = "tx_rate"
+	trafficReceived     = "rx_total"
+	trafficTransmitted  = "tx_total"
+)
+
+// NetworkTraffic reports the throughput or the amount of data received or
+// transmitted by a network interface, from /proc/net/dev.
+type NetworkTraffic struct {
+	Sensor
+	probe     *netDevProbe
+	Interface string
+	property  string
+	interval  time.Duration
+}
+
+func (n *NetworkTraffic) GetSensors() []*Sensor {
+	return []*Sensor{&n.Sensor}
+}
+
+func (n *NetworkTraffic) Enable() {
+	n.Sensor.Disabled = false
+}
+
+func (n *NetworkTraffic) Disable() {
+	n.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (n *NetworkTraffic) Interval() time.Duration {
+	return n.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (n *NetworkTraffic) SetInterval(interval time.Duration) {
+	n.interval = interval
+}
+
+func (n *NetworkTraffic) Update() error {
+	sample, err := n.probe.Get()
+	if err != nil {
+		return err
+	}
+	traffic, ok := sample.interfaces[n.Interface]
+	if !ok {
+		n.State = StateUnavailable
+		return errors.New("interface " + n.Interface + " not found")
+	}
+
+	switch n.property {
+	case trafficReceiveRate:
+		n.State = traffic.rxRate
+	case trafficTransmitRate:
+		n.State = traffic.txRate
+	case trafficReceived:
+		n.State = traffic.rx
+	case trafficTransmitted:
+		n.State = traffic.tx
+	}
+	n.Attributes = map[string]any{
+		"interface":     n.Interface,
+		"default_route": sample.defaultRoute[n.Interface],
+	}
+	return nil
+}
+
+type interfaceTraffic struct {
+	// Bytes received and transmitted since the interface came up
+	rx, tx uint64
+	// Bytes per second since the previous sample
+	rxRate, txRate float64
+}
+
+type netDevSample struct {
+	interfaces map[string]interfaceTraffic
+	// Interfaces the default IPv4 or IPv6 route goes through
+	defaultRoute map[string]bool
+	taken        time.Time
+}
+
+// netDevProbe reads /proc/net/dev and computes the rates since the previous
+// read, sharing the result between the traffic sensors for a short while.
+type netDevProbe struct {
+	mu     sync.Mutex
+	fs     procfs.FS
+	sample *netDevSample
+}
+
+func (p *netDevProbe) Get() (*netDevSample, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.sample != nil && time.Since(p.sample.taken) < time.Second {
+		return p.sample, nil
+	}
+
+	dev, err := p.fs.NetDev()
+	if err != nil {
+		return nil, err
+	}
+	sample := &netDevSample{
+		interfaces:   map[string]interfaceTraffic{},
+		defaultRoute: defaultRouteInterfaces(),
+		taken:        time.Now(),
+	}
+	for name, line := range dev {
+		traffic := interfaceTraffic{rx: line.RxBytes, tx: line.TxBytes}
+		if p.sample != nil {
+			previous, ok := p.sample.interfaces[name]
+			elapsed := sample.taken.Sub(p.sample.taken).Seconds()
+			// Counters are reset when an interface goes down and up again
+			if ok && elapsed > 0 && traffic.rx >= previous.rx && traffic.tx >= previous.tx {
+				traffic.rxRate = math.Round(float64(traffic.rx-previous.rx)/elapsed*10) / 10
+				traffic.txRate = math.Round(float64(traffic.tx-previous.tx)/elapsed*10) / 10
+			}
+		}
+		sample.interfaces[name] = traffic
+	}
+	p.sample = sample
+	return sample, nil
+}
+
+// defaultRouteInterfaces returns the interfaces of the default routes in
+// /proc/net/route and /proc/net/ipv6_route.
+func defaultRouteInterfaces() map[string]bool {
+	found := map[string]bool{}
+	// Iface Destination Gateway Flags ...
+	forEachLine("/proc/net/route", func(fields []string) {
+		if len(fields) > 1 && fields[1] == "00000000" {
+			found[fields[0]] = true
+		}
+	})
+	// Destination PrefixLength Source SourcePrefixLength NextHop Metric
+	// RefCount Use Flags Iface
+	forEachLine("/proc/net/ipv6_route", func(fields []string) {
+		if len(fields) == 10 && strings.Trim(fields[0], "0") == "" && fields[1] == "00" && fields[9] != "lo" {
+			found[fields[9]] = true
+		}
+	})
+	return found
+}
+
+func forEachLine(path string, fn func(fields []string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fn(strings.Fields(scanner.Text()))
+	}
+}
+
+// isVirtualInterface tells interfaces without hardware, like the loopback,
+// bridges, tunnels and container interfaces, apart from real ones.
+func isVirtualInterface(name string) bool {
+	_, err := os.Stat(filepath.Join("/sys/class/net", name, "device"))
+	return err != nil
+}
+
+func newNetworkTraffic(probe *netDevProbe, iface, property string) *NetworkTraffic {
+	sensor := Sensor{
+		UniqueID:       "network_" + slug(iface) + "_" + property,
+		Type:           "sensor",
+		DeviceClass:    "data_size",
+		EntityCategory: "diagnostic",
+	}
+	switch property {
+	case trafficReceiveRate:
+		sensor.Name = iface + " download rate"
+		sensor.Icon = "mdi:download-network"
+		sensor.DeviceClass = "data_rate"
+		sensor.UnitOfMeasurement = "B/s"
+		sensor.StateClass = "measurement"
+	case trafficTransmitRate:
+		sensor.Name = iface + " upload rate"
+		sensor.Icon = "mdi:upload-network"
+		sensor.DeviceClass = "data_rate"
+		sensor.UnitOfMeasurement = "B/s"
+		sensor.StateClass = "measurement"
+	case trafficReceived:
+		sensor.Name = iface + " data received"
+		sensor.Icon = "mdi:download-network-outline"
+		sensor.UnitOfMeasurement = "B"
+		sensor.StateClass = "total_increasing"
+	case trafficTransmitted:
+		sensor.Name = iface + " data sent"
+		sensor.Icon = "mdi:upload-network-outline"
+		sensor.UnitOfMeasurement = "B"
+		sensor.StateClass = "total_increasing"
+	}
+	return &NetworkTraffic{
+		Sensor:    sensor,
+		probe:     probe,
+		Interface: iface,
+		property:  property,
+		interval:  30 * time.Second,
+	}
+}
+
+// DiscoverNetworkTraffic creates receive and transmit rate and total sensors
+// for the network interfaces in /proc/net/dev. Virtual interfaces are left
+// out unless they match one of the include glob patterns. Interfaces
+// matching exclude are always left out. It returns none, without an error,
+// when no interface is left.
+func DiscoverNetworkTraffic(include, exclude []string) ([]*NetworkTraffic, error) {
+	fs, err := procfs.NewDefaultFS()
+	if err != nil {
+		return nil, err
+	}
+	probe := &netDevProbe{fs: fs}
+	sample, err := probe.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range sample.interfaces {
+		if matchPattern(exclude, name) {
+			continue
+		}
+		if len(include) > 0 {
+			if !matchPattern(include, name) {
+				continue
+			}
+		} else if isVirtualInterface(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	found := []*NetworkTraffic{}
+	for _, name := range names {
+		for _, property := range []string{trafficReceiveRate, trafficTransmitRate, trafficReceived, trafficTransmitted} {
+			n := newNetworkTraffic(probe, name, property)
+			if err := n.Update(); err != nil {
+				return nil, err
+			}
+			found = append(found, n)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return found, nil
+}
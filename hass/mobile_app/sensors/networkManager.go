@@ -1,77 +1,466 @@
 package sensors
 
-import "github.com/godbus/dbus/v5"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	networkManagerDest = "org.freedesktop.NetworkManager"
+	networkManagerPath = "/org/freedesktop/NetworkManager"
+	accessPointPrefix  = "/org/freedesktop/NetworkManager/AccessPoint/"
+	notConnected       = "Not Connected"
+)
+
+// Properties of the active connection reported by the network sensors.
+const (
+	networkConnectionType = "connection_type"
+	networkConnectionName = "connection_name"
+	networkSSID           = "ssid"
+	networkBSSID          = "bssid"
+	networkStrength       = "signal_strength"
+	networkFrequency      = "frequency"
+	networkIPv4           = "ipv4_addresses"
+	networkIPv6           = "ipv6_addresses"
+	networkVPN            = "vpn_active"
+)
+
+// networkTriggers lists the NetworkManager properties that change the state
+// of each network sensor.
+var networkTriggers = map[string][]string{
+	networkConnectionType: {"PrimaryConnection", "ActiveConnections", "Type", "State"},
+	networkConnectionName: {"PrimaryConnection", "ActiveConnections", "Id", "State"},
+	networkSSID:           {"PrimaryConnection", "ActiveConnections", "ActiveAccessPoint", "SpecificObject", "Ssid"},
+	networkBSSID:          {"PrimaryConnection", "ActiveConnections", "ActiveAccessPoint", "SpecificObject", "HwAddress"},
+	networkStrength:       {"PrimaryConnection", "ActiveAccessPoint", "SpecificObject", "Strength"},
+	networkFrequency:      {"PrimaryConnection", "ActiveAccessPoint", "SpecificObject", "Frequency"},
+	networkIPv4:           {"PrimaryConnection", "ActiveConnections", "Ip4Config", "AddressData"},
+	networkIPv6:           {"PrimaryConnection", "ActiveConnections", "Ip6Config", "AddressData"},
+	networkVPN:            {"ActiveConnections", "Vpn", "State"},
+}
 
 type NetworkInterface struct {
 	Sensor
+	probe    *networkProbe
+	property string
+}
+
+func (n *NetworkInterface) GetSensors() []*Sensor {
+	return []*Sensor{&n.Sensor}
+}
+
+func (n *NetworkInterface) Enable() {
+	n.Sensor.Disabled = false
+}
+
+func (n *NetworkInterface) Disable() {
+	n.Sensor.Disabled = true
+}
+
+func (n *NetworkInterface) Update() error {
+	connection, err := n.probe.Get()
+	if err != nil {
+		return err
+	}
+
+	wifi := connection != nil && connection.Type == "802-11-wireless"
+	n.Attributes = nil
+	switch n.property {
+	case networkConnectionType:
+		n.State = notConnected
+		if connection != nil {
+			n.State = connection.Type
+			n.Attributes = map[string]any{
+				"device": connection.Device,
+			}
+		}
+	case networkConnectionName:
+		n.State = notConnected
+		if connection != nil {
+			n.State = connection.Name
+		}
+	case networkSSID:
+		n.State = notConnected
+		if wifi {
+			n.State = connection.SSID
+		}
+	case networkBSSID:
+		n.State = notConnected
+		if wifi {
+			n.State = connection.BSSID
+		}
+	case networkStrength:
+		n.State = StateUnavailable
+		if wifi {
+			n.State = connection.Strength
+		}
+	case networkFrequency:
+		n.State = StateUnavailable
+		if wifi {
+			n.State = connection.Frequency
+		}
+	case networkIPv4:
+		n.State, n.Attributes = StateUnavailable, nil
+		if connection != nil {
+			n.State, n.Attributes = addressesState(connection.IPv4)
+		}
+	case networkIPv6:
+		n.State, n.Attributes = StateUnavailable, nil
+		if connection != nil {
+			n.State, n.Attributes = addressesState(connection.IPv6)
+		}
+	case networkVPN:
+		n.State = connection != nil && len(connection.VPNs) > 0
+		if connection != nil {
+			n.Attributes = map[string]any{
+				"connections": connection.VPNs,
+			}
+		}
+	}
+	return nil
+}
+
+// addressesState reports the first address, without prefix, as state and
+// all of them as attribute.
+func addressesState(addresses []string) (any, map[string]any) {
+	if len(addresses) == 0 {
+		return StateUnavailable, nil
+	}
+	return strings.SplitN(addresses[0], "/", 2)[0], map[string]any{
+		"addresses": addresses,
+	}
+}
+
+// Watch follows the PropertiesChanged signals of NetworkManager and calls
+// notify when a property this sensor depends on changes.
+func (n *NetworkInterface) Watch(notify func(), stop <-chan struct{}) error {
+	conn := n.probe.conn
+	options := []dbus.MatchOption{
+		dbus.WithMatchSender(networkManagerDest),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	err := conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	conn.Signal(c)
+	defer conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(v.Body) < 2 {
+				continue
+			}
+			if !strings.HasPrefix(string(v.Path), networkManagerPath) {
+				continue
+			}
+			// Access points that are in range but not connected change
+			// their strength all the time.
+			if strings.HasPrefix(string(v.Path), accessPointPrefix) && v.Path != n.probe.AccessPoint() {
+				continue
+			}
+			changed, _ := v.Body[1].(map[string]dbus.Variant)
+			for _, property := range networkTriggers[n.property] {
+				if _, ok := changed[property]; ok {
+					n.probe.Invalidate()
+					notify()
+					break
+				}
+			}
+		}
+	}
 }
 
 type ActiveConnection struct {
-	Name  string
-	SSID  string
-	Type  string
-	BSSID string
-	tx    uint64
-	rx    uint64
+	Name      string
+	SSID      string
+	Type      string
+	BSSID     string
+	Device    string
+	Strength  uint8
+	Frequency uint32
+	IPv4      []string
+	IPv6      []string
+	// Names of the active VPN connections
+	VPNs        []string
+	accessPoint dbus.ObjectPath
 }
 
-func getActiveConnection(conn *dbus.Conn) *ActiveConnection {
-	activeConnections, err := conn.Object("org.freedesktop.NetworkManager", "/org/freedesktop/NetworkManager").
-		GetProperty("org.freedesktop.NetworkManager.ActiveConnections")
+// networkProbe queries NetworkManager for the active connection, sharing
+// the result between the network sensors for a short while.
+type networkProbe struct {
+	mu         sync.Mutex
+	conn       *dbus.Conn
+	connection *ActiveConnection
+	updated    time.Time
+}
+
+// Get returns the active connection, or nil when there is none.
+func (p *networkProbe) Get() (*ActiveConnection, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Since(p.updated) < time.Second {
+		return p.connection, nil
+	}
+	connection, err := getActiveConnection(p.conn)
 	if err != nil {
-		return nil
+		return nil, err
 	}
+	p.connection = connection
+	p.updated = time.Now()
+	return connection, nil
+}
 
-	for _, path := range activeConnections.Value().([]dbus.ObjectPath) {
+// Invalidate makes the next Get query NetworkManager again.
+func (p *networkProbe) Invalidate() {
+	p.mu.Lock()
+	p.updated = time.Time{}
+	p.mu.Unlock()
+}
 
-		o := conn.Object("org.freedesktop.NetworkManager", path)
+// AccessPoint returns the access point of the last known connection.
+func (p *networkProbe) AccessPoint() dbus.ObjectPath {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.connection == nil {
+		return ""
+	}
+	return p.connection.accessPoint
+}
+
+func getActiveConnection(conn *dbus.Conn) (*ActiveConnection, error) {
+	activeConnections, err := conn.Object(networkManagerDest, networkManagerPath).
+		GetProperty("org.freedesktop.NetworkManager.ActiveConnections")
+	if err != nil {
+		return nil, err
+	}
+	paths, _ := activeConnections.Value().([]dbus.ObjectPath)
+
+	var connection *ActiveConnection
+	vpns := []string{}
+	for _, path := range paths {
+		o := conn.Object(networkManagerDest, path)
+		name := stringProperty(o, "org.freedesktop.NetworkManager.Connection.Active.Id")
+		t := stringProperty(o, "org.freedesktop.NetworkManager.Connection.Active.Type")
 		vpn, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Vpn")
+		if isVPN, _ := vpn.Value().(bool); isVPN || t == "wireguard" {
+			vpns = append(vpns, name)
+			continue
+		}
+		if connection != nil {
+			continue
+		}
 		isDefault, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Default")
-		if !vpn.Value().(bool) && isDefault.Value().(bool) {
+		isDefault6, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Default6")
+		v4, _ := isDefault.Value().(bool)
+		v6, _ := isDefault6.Value().(bool)
+		if !v4 && !v6 {
+			continue
+		}
+
+		connection = &ActiveConnection{
+			Name: name,
+			Type: t,
+		}
+		connection.IPv4 = getAddresses(conn, o, "Ip4Config", "IP4Config")
+		connection.IPv6 = getAddresses(conn, o, "Ip6Config", "IP6Config")
 
-			name, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Id")
-			t, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Type")
-			// devices, err := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Devices")
-			ob, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.SpecificObject")
+		devices, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.Devices")
+		devicePaths, _ := devices.Value().([]dbus.ObjectPath)
+		var device dbus.BusObject
+		if len(devicePaths) > 0 {
+			device = conn.Object(networkManagerDest, devicePaths[0])
+			connection.Device = stringProperty(device, "org.freedesktop.NetworkManager.Device.Interface")
+		}
 
-			connection := ActiveConnection{
-				Name: name.Value().(string),
-				Type: t.Value().(string),
+		if t == "802-11-wireless" {
+			specific, _ := o.GetProperty("org.freedesktop.NetworkManager.Connection.Active.SpecificObject")
+			apPath, _ := specific.Value().(dbus.ObjectPath)
+			if (apPath == "" || apPath == "/") && device != nil {
+				active, _ := device.GetProperty("org.freedesktop.NetworkManager.Device.Wireless.ActiveAccessPoint")
+				apPath, _ = active.Value().(dbus.ObjectPath)
 			}
-			if t.Value().(string) == "802-11-wireless" {
-				ap := getAccessPoint(conn, ob.Value().(dbus.ObjectPath))
+			if ap := getAccessPoint(conn, apPath); ap != nil {
 				connection.SSID = ap.SSID
 				connection.BSSID = ap.BSSID
+				connection.Strength = ap.Strength
+				connection.Frequency = ap.Frequency
+				connection.accessPoint = apPath
 			}
+		}
+	}
 
-			return &connection
+	if connection == nil {
+		if len(vpns) == 0 {
+			return nil, nil
 		}
+		connection = &ActiveConnection{}
+	}
+	connection.VPNs = vpns
+	return connection, nil
+}
 
+// getAddresses returns the addresses, with prefix, of the IP4Config or
+// IP6Config of an active connection.
+func getAddresses(conn *dbus.Conn, active dbus.BusObject, property, iface string) []string {
+	config, err := active.GetProperty("org.freedesktop.NetworkManager.Connection.Active." + property)
+	if err != nil {
+		return nil
 	}
-	return nil
+	path, _ := config.Value().(dbus.ObjectPath)
+	if path == "" || path == "/" {
+		return nil
+	}
+	data, err := conn.Object(networkManagerDest, path).
+		GetProperty("org.freedesktop.NetworkManager." + iface + ".AddressData")
+	if err != nil {
+		return nil
+	}
+	entries, _ := data.Value().([]map[string]dbus.Variant)
+	addresses := []string{}
+	for _, entry := range entries {
+		address, _ := entry["address"].Value().(string)
+		prefix, _ := entry["prefix"].Value().(uint32)
+		if address != "" {
+			addresses = append(addresses, fmt.Sprintf("%s/%d", address, prefix))
+		}
+	}
+	return addresses
+}
+
+func stringProperty(o dbus.BusObject, property string) string {
+	v, err := o.GetProperty(property)
+	if err != nil {
+		return ""
+	}
+	s, _ := v.Value().(string)
+	return s
 }
 
 type AP struct {
-	BSSID string
-	SSID  string
+	BSSID     string
+	SSID      string
+	Strength  uint8
+	Frequency uint32
 }
 
-func getAccessPoint(conn *dbus.Conn, op dbus.ObjectPath) (ap *AP) {
+func getAccessPoint(conn *dbus.Conn, op dbus.ObjectPath) *AP {
+	if op == "" || op == "/" {
+		return nil
+	}
 
-	o := conn.Object("org.freedesktop.NetworkManager", op)
+	o := conn.Object(networkManagerDest, op)
 	ssid, err := o.GetProperty("org.freedesktop.NetworkManager.AccessPoint.Ssid")
 	if err != nil {
-		return ap
-	}
-	hwaddress, err := o.GetProperty("org.freedesktop.NetworkManager.AccessPoint.HwAddress")
-	if err != nil {
-		return ap
+		return nil
 	}
+	ap := &AP{}
+	// The SSID is a byte array, not necessarily valid UTF-8.
+	raw, _ := ssid.Value().([]byte)
+	ap.SSID = string(raw)
+	ap.BSSID = stringProperty(o, "org.freedesktop.NetworkManager.AccessPoint.HwAddress")
 
-	ap.SSID = ssid.Value().(string)
-	ap.BSSID = hwaddress.Value().(string)
+	if strength, err := o.GetProperty("org.freedesktop.NetworkManager.AccessPoint.Strength"); err == nil {
+		ap.Strength, _ = strength.Value().(uint8)
+	}
+	if frequency, err := o.GetProperty("org.freedesktop.NetworkManager.AccessPoint.Frequency"); err == nil {
+		ap.Frequency, _ = frequency.Value().(uint32)
+	}
 
 	return ap
 }
 
-// TODO
+func newNetworkInterface(probe *networkProbe, property string, sensor Sensor) *NetworkInterface {
+	sensor.UniqueID = "network_" + property
+	if sensor.Type == "" {
+		sensor.Type = "sensor"
+	}
+	return &NetworkInterface{
+		Sensor:   sensor,
+		probe:    probe,
+		property: property,
+	}
+}
+
+// DiscoverNetwork creates the network sensors when NetworkManager is
+// available on the system bus.
+func DiscoverNetwork(systemdbus *dbus.Conn) ([]*NetworkInterface, error) {
+	_, err := systemdbus.Object(networkManagerDest, networkManagerPath).
+		GetProperty("org.freedesktop.NetworkManager.Version")
+	if err != nil {
+		return nil, err
+	}
+
+	probe := &networkProbe{conn: systemdbus}
+	network := []*NetworkInterface{
+		newNetworkInterface(probe, networkConnectionType, Sensor{
+			Name: "Connection type",
+			Icon: "mdi:network",
+		}),
+		newNetworkInterface(probe, networkConnectionName, Sensor{
+			Name: "Connection name",
+			Icon: "mdi:network",
+		}),
+		newNetworkInterface(probe, networkSSID, Sensor{
+			Name: "WiFi SSID",
+			Icon: "mdi:wifi",
+		}),
+		newNetworkInterface(probe, networkBSSID, Sensor{
+			Name:           "WiFi BSSID",
+			Icon:           "mdi:wifi-star",
+			EntityCategory: "diagnostic",
+		}),
+		newNetworkInterface(probe, networkStrength, Sensor{
+			Name:              "WiFi signal strength",
+			Icon:              "mdi:wifi-strength-3",
+			UnitOfMeasurement: "%",
+			StateClass:        "measurement",
+			EntityCategory:    "diagnostic",
+		}),
+		newNetworkInterface(probe, networkFrequency, Sensor{
+			Name:              "WiFi frequency",
+			Icon:              "mdi:wifi-cog",
+			DeviceClass:       "frequency",
+			UnitOfMeasurement: "MHz",
+			StateClass:        "measurement",
+			EntityCategory:    "diagnostic",
+		}),
+		newNetworkInterface(probe, networkIPv4, Sensor{
+			Name:           "IPv4 address",
+			Icon:           "mdi:ip",
+			EntityCategory: "diagnostic",
+		}),
+		newNetworkInterface(probe, networkIPv6, Sensor{
+			Name:           "IPv6 address",
+			Icon:           "mdi:ip",
+			EntityCategory: "diagnostic",
+		}),
+		newNetworkInterface(probe, networkVPN, Sensor{
+			Name: "VPN active",
+			Icon: "mdi:vpn",
+			Type: "binary_sensor",
+		}),
+	}
+
+	for _, n := range network {
+		err := n.Update()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return network, nil
+}
@@ -0,0 +1,255 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	packageKitDest        = "org.freedesktop.PackageKit"
+	packageKitPath        = "/org/freedesktop/PackageKit"
+	packageKitTransaction = "org.freedesktop.PackageKit.Transaction"
+	// PK_FILTER_ENUM_NONE as a filter bitfield
+	packageKitFilterNone = 1 << 1
+	// PK_INFO_ENUM_SECURITY
+	packageKitInfoSecurity = 8
+)
+
+// Updates reports the number of pending package updates, from PackageKit.
+// Listing them can take up to a minute, so that runs in the background and
+// the sensor is sent once it is done.
+type Updates struct {
+	Sensor
+	conn     *dbus.Conn
+	Timeout  time.Duration
+	interval time.Duration
+
+	mu       sync.Mutex
+	notify   func()
+	checking bool
+	// checked is set when a check finished that the sensor doesn't report
+	// yet, with its result in packages and err.
+	checked  bool
+	packages map[string]uint32
+	err      error
+}
+
+func (u *Updates) GetSensors() []*Sensor {
+	return []*Sensor{&u.Sensor}
+}
+
+func (u *Updates) Enable() {
+	u.Sensor.Disabled = false
+}
+
+func (u *Updates) Disable() {
+	u.Sensor.Disabled = true
+}
+
+// Interval returns how often the updates are checked.
+func (u *Updates) Interval() time.Duration {
+	return u.interval
+}
+
+// SetInterval changes how often the updates are checked.
+func (u *Updates) SetInterval(interval time.Duration) {
+	u.interval = interval
+}
+
+// Update reports the result of the last check for updates. Unless that is a
+// check the sensor didn't report yet, a new check is started, and the state
+// of the last one is kept until it is done.
+func (u *Updates) Update() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.checked {
+		u.check()
+		return u.err
+	}
+	u.checked = false
+	if u.err != nil {
+		return u.err
+	}
+	packages := u.packages
+
+	names := []string{}
+	security := 0
+	for id, info := range packages {
+		// A package ID is name;version;arch;data
+		names = append(names, strings.SplitN(id, ";", 2)[0])
+		if info == packageKitInfoSecurity {
+			security++
+		}
+	}
+	sort.Strings(names)
+	u.State = len(packages)
+	u.Attributes = map[string]any{
+		"security": security,
+		"packages": names,
+	}
+	return nil
+}
+
+// check lists the pending updates in the background, unless that is running
+// already, and notifies the collector when done.
+func (u *Updates) check() {
+	if u.checking {
+		return
+	}
+	u.checking = true
+	go func() {
+		packages, err := getUpdates(u.conn, u.Timeout)
+		u.mu.Lock()
+		u.checking, u.checked = false, true
+		u.packages, u.err = packages, err
+		notify := u.notify
+		u.mu.Unlock()
+		if notify != nil {
+			notify()
+		}
+	}()
+}
+
+// Watch follows the UpdatesChanged signal of PackageKit, sent after the
+// package cache was refreshed or packages were updated.
+func (u *Updates) Watch(notify func(), stop <-chan struct{}) error {
+	u.mu.Lock()
+	u.notify = notify
+	checked := u.checked
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.notify = nil
+		u.mu.Unlock()
+	}()
+	// A check may have finished before there was anyone to tell
+	if checked {
+		notify()
+	}
+
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(packageKitPath),
+		dbus.WithMatchInterface(packageKitDest),
+		dbus.WithMatchMember("UpdatesChanged"),
+	}
+	err := u.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer u.conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	u.conn.Signal(c)
+	defer u.conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Path == packageKitPath && v.Name == packageKitDest+".UpdatesChanged" {
+				notify()
+			}
+		}
+	}
+}
+
+// getUpdates runs a GetUpdates transaction and returns the info enum of
+// each package that can be updated, by package ID.
+func getUpdates(conn *dbus.Conn, timeout time.Duration) (map[string]uint32, error) {
+	var transaction dbus.ObjectPath
+	err := conn.Object(packageKitDest, packageKitPath).
+		Call(packageKitDest+".CreateTransaction", 0).
+		Store(&transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(transaction),
+		dbus.WithMatchInterface(packageKitTransaction),
+	}
+	err = conn.AddMatchSignal(options...)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 100)
+	conn.Signal(c)
+	defer conn.RemoveSignal(c)
+
+	err = conn.Object(packageKitDest, transaction).
+		Call(packageKitTransaction+".GetUpdates", 0, uint64(packageKitFilterNone)).Err
+	if err != nil {
+		return nil, err
+	}
+
+	packages := map[string]uint32{}
+	deadline := time.After(timeout)
+	for {
+		select {
+		case <-deadline:
+			return nil, fmt.Errorf("PackageKit didn't answer within %v", timeout)
+		case v, ok := <-c:
+			if !ok {
+				return nil, errors.New("connection to the system bus closed")
+			}
+			if v.Path != transaction {
+				continue
+			}
+			switch v.Name {
+			case packageKitTransaction + ".Package":
+				// Package(info, package_id, summary)
+				if len(v.Body) < 2 {
+					continue
+				}
+				info, _ := v.Body[0].(uint32)
+				id, _ := v.Body[1].(string)
+				packages[id] = info
+			case packageKitTransaction + ".ErrorCode":
+				// ErrorCode(code, details)
+				if len(v.Body) < 2 {
+					return nil, errors.New("PackageKit transaction failed")
+				}
+				return nil, fmt.Errorf("PackageKit transaction failed: %v", v.Body[1])
+			case packageKitTransaction + ".Finished":
+				return packages, nil
+			}
+		}
+	}
+}
+
+// DiscoverUpdates creates the pending updates sensor when PackageKit is
+// available on the system bus. Listing the updates can take a while, so it
+// is left to the first update of the sensor.
+func DiscoverUpdates(systemdbus *dbus.Conn) (*Updates, error) {
+	_, err := systemdbus.Object(packageKitDest, packageKitPath).
+		GetProperty(packageKitDest + ".VersionMajor")
+	if err != nil {
+		return nil, err
+	}
+
+	updates := &Updates{
+		Sensor: Sensor{
+			Name:       "Pending updates",
+			UniqueID:   "pending_updates",
+			Type:       "sensor",
+			Icon:       "mdi:package-up",
+			StateClass: "measurement",
+		},
+		conn:     systemdbus,
+		Timeout:  time.Minute,
+		interval: 6 * time.Hour,
+	}
+	return updates, nil
+}
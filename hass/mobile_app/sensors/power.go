@@ -0,0 +1,334 @@
+package sensors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// power-profiles-daemon moved to the UPower namespace in version 0.20, and
+// still answers on the old name.
+var powerProfilesNames = []struct {
+	dest, path string
+}{
+	{"org.freedesktop.UPower.PowerProfiles", "/org/freedesktop/UPower/PowerProfiles"},
+	{"net.hadess.PowerProfiles", "/net/hadess/PowerProfiles"},
+}
+
+// Values reported by the power sensors.
+const (
+	powerProfile = "power_profile"
+	powerAC      = "ac_power"
+)
+
+// Power reports the active power profile, or whether the machine runs on
+// AC power.
+type Power struct {
+	Sensor
+	conn     *dbus.Conn
+	property string
+	// D-Bus name and path of power-profiles-daemon
+	dest string
+	path dbus.ObjectPath
+}
+
+func (p *Power) GetSensors() []*Sensor {
+	return []*Sensor{&p.Sensor}
+}
+
+func (p *Power) Enable() {
+	p.Sensor.Disabled = false
+}
+
+func (p *Power) Disable() {
+	p.Sensor.Disabled = true
+}
+
+func (p *Power) Update() error {
+	switch p.property {
+	case powerProfile:
+		o := p.conn.Object(p.dest, p.path)
+		p.State = stringProperty(o, p.dest+".ActiveProfile")
+		if p.State == "" {
+			return errors.New("no active power profile")
+		}
+		profiles := []string{}
+		if variant, err := o.GetProperty(p.dest + ".Profiles"); err == nil {
+			list, _ := variant.Value().([]map[string]dbus.Variant)
+			for _, profile := range list {
+				if name, ok := profile["Profile"].Value().(string); ok {
+					profiles = append(profiles, name)
+				}
+			}
+		}
+		p.Attributes = map[string]any{
+			"profiles": profiles,
+		}
+	case powerAC:
+		onBattery, err := p.conn.Object(upowerDest, upowerPath).GetProperty(upowerDest + ".OnBattery")
+		if err != nil {
+			return err
+		}
+		battery, _ := onBattery.Value().(bool)
+		p.State = !battery
+	}
+	return nil
+}
+
+// Watch follows the PropertiesChanged signals of power-profiles-daemon or
+// UPower and calls notify when the reported property changes.
+func (p *Power) Watch(notify func(), stop <-chan struct{}) error {
+	path, iface, property := p.path, p.dest, "ActiveProfile"
+	if p.property == powerAC {
+		path, iface, property = upowerPath, upowerDest, "OnBattery"
+	}
+	options := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	err := p.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer p.conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	p.conn.Signal(c)
+	defer p.conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Path != path || v.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(v.Body) < 2 {
+				continue
+			}
+			if changedIface, _ := v.Body[0].(string); changedIface != iface {
+				continue
+			}
+			changed, _ := v.Body[1].(map[string]dbus.Variant)
+			if _, ok := changed[property]; ok {
+				notify()
+			}
+		}
+	}
+}
+
+// findPowerProfiles returns the D-Bus name and path power-profiles-daemon
+// answers on.
+func findPowerProfiles(conn *dbus.Conn) (string, dbus.ObjectPath, error) {
+	var err error
+	for _, name := range powerProfilesNames {
+		path := dbus.ObjectPath(name.path)
+		_, err = conn.Object(name.dest, path).GetProperty(name.dest + ".ActiveProfile")
+		if err == nil {
+			return name.dest, path, nil
+		}
+	}
+	return "", "", err
+}
+
+// SetPowerProfile activates a power profile, like power-saver, balanced or
+// performance.
+func SetPowerProfile(conn *dbus.Conn, profile string) error {
+	dest, path, err := findPowerProfiles(conn)
+	if err != nil {
+		return err
+	}
+	return conn.Object(dest, path).SetProperty(dest+".ActiveProfile", dbus.MakeVariant(profile))
+}
+
+// DiscoverPower creates the AC power sensor when UPower is available, and
+// the power profile sensor when power-profiles-daemon is.
+func DiscoverPower(systemdbus *dbus.Conn) ([]*Power, error) {
+	found := []*Power{}
+
+	ac := &Power{
+		Sensor: Sensor{
+			Name:        "AC power",
+			UniqueID:    powerAC,
+			Type:        "binary_sensor",
+			Icon:        "mdi:power-plug",
+			DeviceClass: "plug",
+		},
+		conn:     systemdbus,
+		property: powerAC,
+	}
+	if err := ac.Update(); err == nil {
+		found = append(found, ac)
+	}
+
+	if dest, path, err := findPowerProfiles(systemdbus); err == nil {
+		profile := &Power{
+			Sensor: Sensor{
+				Name:     "Power profile",
+				UniqueID: powerProfile,
+				Type:     "sensor",
+				Icon:     "mdi:speedometer",
+			},
+			conn:     systemdbus,
+			property: powerProfile,
+			dest:     dest,
+			path:     path,
+		}
+		if err := profile.Update(); err == nil {
+			found = append(found, profile)
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, errors.New("neither UPower nor power-profiles-daemon found")
+	}
+	return found, nil
+}
+
+// Backlight reports the brightness of a display backlight, in percent.
+type Backlight struct {
+	Sensor
+	dir      string
+	interval time.Duration
+}
+
+func (b *Backlight) GetSensors() []*Sensor {
+	return []*Sensor{&b.Sensor}
+}
+
+func (b *Backlight) Enable() {
+	b.Sensor.Disabled = false
+}
+
+func (b *Backlight) Disable() {
+	b.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (b *Backlight) Interval() time.Duration {
+	return b.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (b *Backlight) SetInterval(interval time.Duration) {
+	b.interval = interval
+}
+
+func (b *Backlight) Update() error {
+	brightness, maximum, err := readBacklight(b.dir)
+	if err != nil {
+		return err
+	}
+	b.State = math.Round(float64(brightness) / float64(maximum) * 100)
+	b.Attributes = map[string]any{
+		"device":         filepath.Base(b.dir),
+		"brightness":     brightness,
+		"max_brightness": maximum,
+	}
+	return nil
+}
+
+func readBacklight(dir string) (brightness, maximum int64, err error) {
+	brightness, err = readSysfsInt(filepath.Join(dir, "brightness"))
+	if err != nil {
+		return 0, 0, err
+	}
+	maximum, err = readSysfsInt(filepath.Join(dir, "max_brightness"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if maximum <= 0 {
+		return 0, 0, errors.New("backlight has no maximum brightness")
+	}
+	return brightness, maximum, nil
+}
+
+var errNoBacklight = errors.New("no backlight found")
+
+// findBacklight returns the sysfs directory of the backlight to use. Like
+// the kernel documentation advises, firmware interfaces are preferred over
+// platform and raw ones.
+func findBacklight() (string, error) {
+	dirs, _ := filepath.Glob("/sys/class/backlight/*")
+	if len(dirs) == 0 {
+		return "", errNoBacklight
+	}
+	rank := map[string]int{"firmware": 0, "platform": 1, "raw": 2}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		ti, ok := rank[readSysfsString(filepath.Join(dirs[i], "type"))]
+		if !ok {
+			ti = len(rank)
+		}
+		tj, ok := rank[readSysfsString(filepath.Join(dirs[j], "type"))]
+		if !ok {
+			tj = len(rank)
+		}
+		return ti < tj
+	})
+	return dirs[0], nil
+}
+
+// SetBrightness sets the brightness of the backlight to percent. Writing to
+// sysfs needs root, so it goes through systemd-logind, which allows the user
+// of the active session to change it.
+func SetBrightness(systemdbus *dbus.Conn, percent float64) error {
+	dir, err := findBacklight()
+	if err != nil {
+		return err
+	}
+	_, maximum, err := readBacklight(dir)
+	if err != nil {
+		return err
+	}
+	session, err := findSession(systemdbus)
+	if err != nil {
+		return err
+	}
+	percent = math.Max(0, math.Min(100, percent))
+	value := uint32(math.Round(percent / 100 * float64(maximum)))
+	call := systemdbus.Object(logindDest, session).
+		Call(logindSession+".SetBrightness", 0, "backlight", filepath.Base(dir), value)
+	if call.Err != nil {
+		return fmt.Errorf("setting brightness: %v", call.Err)
+	}
+	return nil
+}
+
+// DiscoverBacklight creates the brightness sensor for the display backlight.
+// It returns nil, without an error, when there is no backlight.
+func DiscoverBacklight() (*Backlight, error) {
+	dir, err := findBacklight()
+	if err == errNoBacklight {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "brightness")); err != nil {
+		return nil, err
+	}
+	backlight := &Backlight{
+		Sensor: Sensor{
+			Name:              "Screen brightness",
+			UniqueID:          "screen_brightness",
+			Type:              "sensor",
+			Icon:              "mdi:brightness-6",
+			UnitOfMeasurement: "%",
+		},
+		dir:      dir,
+		interval: 10 * time.Second,
+	}
+	err = backlight.Update()
+	if err != nil {
+		return nil, err
+	}
+	return backlight, nil
+}
@@ -1,6 +1,11 @@
 package sensors
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -8,6 +13,9 @@ import (
 	"github.com/subutux/hass_companion/internal/logger"
 )
 
+// StateUnavailable marks a sensor as unavailable in Home Assistant.
+const StateUnavailable = "unavailable"
+
 type Sensor struct {
 	Attributes        map[string]any `json:"attributes,omitempty"`
 	DeviceClass       string         `json:"device_class,omitempty"`
@@ -20,14 +28,67 @@ type Sensor struct {
 	StateClass        string         `json:"state_class,omitempty"`
 	EntityCategory    string         `json:"entity_category,omitempty"`
 	Disabled          bool           `json:"disabled,omitempty"`
+	// LastError holds the last error Home Assistant reported for this sensor.
+	LastError *SensorError `json:"-"`
+	// UpdateError holds the error of the last update of the sensor, until an
+	// update succeeds again. The sensor is unavailable meanwhile.
+	UpdateError error `json:"-"`
+	// ErrorCount counts the failed updates of the sensor.
+	ErrorCount int `json:"-"`
+	// okAttributes holds the attributes of the sensor before its update
+	// failed, for sensors that don't set them on every update.
+	okAttributes map[string]any
+	// Threshold is the minimal change of a numeric state before it is sent
+	// to Home Assistant. Attribute changes alone are not sent when set.
+	Threshold float64 `json:"-"`
 }
 
 type SensorInterface interface {
+	// GetSensors returns the sensors as of the last update.
 	GetSensors() []*Sensor
+	// Update refreshes the state of the sensors. On an error they are
+	// reported unavailable.
+	Update() error
 	Disable()
 	Enable()
 }
 
+// SensorWatcher is implemented by sensors that can push their own changes
+// instead of waiting for the collector to poll them.
+type SensorWatcher interface {
+	SensorInterface
+	// Watch blocks and calls notify whenever the sensor changed, until stop
+	// is closed. An error means the sensor can't be watched and should be
+	// polled instead.
+	Watch(notify func(), stop <-chan struct{}) error
+}
+
+// SensorSender is implemented by watched sensors whose changes must reach
+// Home Assistant before they carry on, like the system going to sleep.
+type SensorSender interface {
+	SensorWatcher
+	// SetSend gives the sensor a function that applies change to it and
+	// sends it to Home Assistant right away, skipping the debounce. It
+	// returns once the sensor was sent.
+	SetSend(send func(change func()))
+}
+
+// SensorPoller is implemented by sensors that want to be polled on their own
+// interval instead of the interval of the collector. Sensors that are
+// watched as well are polled on top of that.
+type SensorPoller interface {
+	SensorInterface
+	Interval() time.Duration
+	SetInterval(interval time.Duration)
+}
+
+// SensorPrivacy is implemented by sensors that report personal data, like
+// window titles, and can leave it out.
+type SensorPrivacy interface {
+	SensorInterface
+	SetPrivate(private bool)
+}
+
 type SensorUpdate struct {
 	Attributes map[string]any `json:"attributes,omitempty"`
 	Icon       string         `json:"icon,omitempty"`
@@ -70,28 +131,110 @@ func NewSensorUpdates(sensors []*SensorUpdate) *SensorUpdates {
 	}
 }
 
+// Error codes Home Assistant returns for a single sensor in the
+// update_sensor_states response.
+const (
+	SensorErrorNotRegistered = "not_registered"
+	SensorErrorInvalidFormat = "invalid_format"
+)
+
+// SensorError is an error reported by Home Assistant for a single sensor.
+type SensorError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *SensorError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// SensorUpdateResponse is the per-sensor result of an update_sensor_states
+// call, keyed by unique_id in the response body.
+type SensorUpdateResponse struct {
+	Success    bool         `json:"success"`
+	IsDisabled bool         `json:"is_disabled,omitempty"`
+	Error      *SensorError `json:"error,omitempty"`
+}
+
+// ParseSensorUpdateResponse decodes the body of an update_sensor_states call.
+// Entries that don't have the expected shape are skipped.
+func ParseSensorUpdateResponse(body []byte) (map[string]*SensorUpdateResponse, error) {
+	response := map[string]*SensorUpdateResponse{}
+	if len(body) == 0 {
+		return response, nil
+	}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return response, err
+	}
+	for id, data := range raw {
+		var r SensorUpdateResponse
+		if err := json.Unmarshal(data, &r); err != nil {
+			logger.I().Warn("Unexpected sensor update response", "sensor", id, "response", string(data))
+			continue
+		}
+		response[id] = &r
+	}
+	return response, nil
+}
+
 type Collector struct {
-	mu       sync.Mutex
+	mu sync.Mutex
+	// sensorMu guards the settings of the sensors, like their name, icon
+	// and unique ID, while they are sent or changed with Reconfigure.
+	sensorMu sync.Mutex
 	StopChan chan struct{}
 	Sensors  []SensorInterface
 	// List containing the Unique IDs of registered sensors
 	RegisteredSensors []string
 	// List containing the Unique IDs of Disabled sensors
 	DisabledSensors []string
-	ticker          *time.Ticker
-	Interval        time.Duration
-	Webhook         string
+	// RegistryChanged is called when RegisteredSensors or DisabledSensors
+	// changed, so they can be kept across restarts.
+	RegistryChanged func()
+	// Unique IDs of the sensors registered by this collector. Sensors are
+	// registered again once per start, so a changed name, unit or class of
+	// a sensor reaches Home Assistant.
+	registered map[string]bool
+	// Sensors seen during the last collection, by Unique ID
+	collected map[string]*Sensor
+	// Sensors that are watched or polled on their own interval, and thus
+	// skipped by the collector ticker.
+	scheduled map[SensorInterface]chan struct{}
+	updates   chan SensorInterface
+	running   bool
+	ticker    *time.Ticker
+	Interval  time.Duration
+	// Heartbeat is the interval at which all sensors are sent, changed or
+	// not. Zero sends all sensors on every collection.
+	Heartbeat time.Duration
+	// Last update sent to Home Assistant, by Unique ID
+	lastSent map[string]*SensorUpdate
+	// Debounce is the time to wait for more changes after a sensor
+	// reported one, before sending the changed sensors. Zero sends changes
+	// immediately.
+	Debounce time.Duration
+	Webhook  string
 }
 
 func NewCollector(webhook string, interval time.Duration) *Collector {
 	return &Collector{
-		mu:       sync.Mutex{},
-		Webhook:  webhook,
-		Interval: interval,
+		mu:         sync.Mutex{},
+		Webhook:    webhook,
+		Interval:   interval,
+		Debounce:   2 * time.Second,
+		Heartbeat:  15 * time.Minute,
+		collected:  map[string]*Sensor{},
+		registered: map[string]bool{},
+		lastSent:   map[string]*SensorUpdate{},
+		scheduled:  map[SensorInterface]chan struct{}{},
+		updates:    make(chan SensorInterface, 16),
 	}
 }
 
 func (c *Collector) IsRegistered(sensor *Sensor) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, id := range c.RegisteredSensors {
 		if id == sensor.UniqueID {
 			return true
@@ -100,24 +243,135 @@ func (c *Collector) IsRegistered(sensor *Sensor) bool {
 	return false
 }
 
+// registeredNow reports whether the sensor was registered since the
+// collector was created.
+func (c *Collector) registeredNow(sensor *Sensor) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.registered[sensor.UniqueID]
+}
+
 func (c *Collector) IsDisabled(sensor *Sensor) bool {
+	return c.isDisabledID(sensor.UniqueID)
+}
+
+func (c *Collector) isDisabledID(uniqueID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	for _, id := range c.DisabledSensors {
-		if id == sensor.UniqueID {
+		if id == uniqueID {
 			return true
 		}
 	}
 	return false
 }
 
-// HandleUpdateResponse checks if sensors are disabled
-func (c *Collector) HandleUpdateResponse(response map[string]any) {
+func (c *Collector) setRegistered(id string, registered bool) {
+	c.mu.Lock()
+	var changed bool
+	c.RegisteredSensors, changed = toggle(c.RegisteredSensors, id, registered)
+	if registered {
+		c.registered[id] = true
+	} else {
+		delete(c.registered, id)
+	}
+	c.mu.Unlock()
+	if changed {
+		c.registryChanged()
+	}
+}
+
+func (c *Collector) setDisabled(id string, disabled bool) {
+	c.mu.Lock()
+	var changed bool
+	c.DisabledSensors, changed = toggle(c.DisabledSensors, id, disabled)
+	c.mu.Unlock()
+	if changed {
+		c.registryChanged()
+	}
+}
+
+func (c *Collector) registryChanged() {
+	if c.RegistryChanged != nil {
+		c.RegistryChanged()
+	}
+}
+
+// Registry returns copies of RegisteredSensors and DisabledSensors.
+func (c *Collector) Registry() (registered, disabled []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string{}, c.RegisteredSensors...), append([]string{}, c.DisabledSensors...)
+}
+
+// toggle adds or removes id from list, keeping entries unique, and reports
+// whether the list changed.
+func toggle(list []string, id string, present bool) ([]string, bool) {
+	for i, v := range list {
+		if v == id {
+			if present {
+				return list, false
+			}
+			return append(list[:i], list[i+1:]...), true
+		}
+	}
+	if present {
+		return append(list, id), true
+	}
+	return list, false
+}
+
+// findSensor looks up a sensor seen during the last collection by its
+// unique ID.
+func (c *Collector) findSensor(id string) *Sensor {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.collected[id]
+}
+
+// HandleUpdateResponse processes the per-sensor results of an
+// update_sensor_states call. It keeps the disabled state in sync with Home
+// Assistant, re-registers sensors Home Assistant no longer knows about and
+// records errors on the sensors they belong to.
+func (c *Collector) HandleUpdateResponse(response map[string]*SensorUpdateResponse) {
+	c.sensorMu.Lock()
+	defer c.sensorMu.Unlock()
 	for id, r := range response {
-		for v, val := range r.(map[string]any) {
-			if v == "is_disabled" {
-				if val.(bool) {
-					c.DisabledSensors = append(c.DisabledSensors, id)
-				}
+		if r == nil {
+			continue
+		}
+		sensor := c.findSensor(id)
+		if r.Success {
+			if !r.IsDisabled && c.isDisabledID(id) {
+				// Enabled again in Home Assistant, send its current state.
+				c.forget(id)
+			}
+			c.setDisabled(id, r.IsDisabled)
+			if sensor != nil {
+				sensor.Disabled = r.IsDisabled
+				sensor.LastError = nil
+			}
+			continue
+		}
+
+		if r.Error == nil {
+			r.Error = &SensorError{Code: "unknown", Message: "update failed without an error"}
+		}
+		logger.I().Warn("Sensor update failed", "sensor", id, "error", r.Error)
+		c.forget(id)
+		if sensor == nil {
+			continue
+		}
+		sensor.LastError = r.Error
+
+		if r.Error.Code == SensorErrorNotRegistered {
+			c.setRegistered(id, false)
+			_, err := c.RegisterSensor(sensor)
+			if err != nil {
+				logger.I().Error("Failed to re-register sensor", "sensor", id, "error", err)
+				continue
 			}
+			c.setRegistered(id, true)
 		}
 	}
 }
@@ -125,59 +379,421 @@ func (c *Collector) HandleUpdateResponse(response map[string]any) {
 func (c *Collector) AddSensors(sensors ...SensorInterface) {
 	c.mu.Lock()
 	c.Sensors = append(c.Sensors, sensors...)
+	running := c.running
 	c.mu.Unlock()
+
+	if running {
+		for _, sensor := range sensors {
+			c.schedule(sensor)
+			c.notify(sensor)
+		}
+	}
 }
 
 func (c *Collector) AddSensor(sensor SensorInterface) {
 	c.AddSensors(sensor)
 }
 
-func (c *Collector) Collect() {
+// notify queues the sensor to be sent to Home Assistant.
+func (c *Collector) notify(sensor SensorInterface) {
+	select {
+	case c.updates <- sensor:
+	case <-c.StopChan:
+	}
+}
+
+// schedule starts watching the sensor, and polling it on its own interval,
+// when it supports it. Sensors that support neither are left to the
+// collector ticker.
+func (c *Collector) schedule(sensor SensorInterface) {
+	watcher, watched := sensor.(SensorWatcher)
+	poller, polled := sensor.(SensorPoller)
+	polled = polled && poller.Interval() > 0
+	if !watched && !polled {
+		return
+	}
+	stop := c.setScheduled(sensor)
+
+	if watched {
+		if sender, ok := sensor.(SensorSender); ok {
+			sender.SetSend(func(change func()) {
+				c.Reconfigure(change)
+				c.send(false, sensor)
+			})
+		}
+		go func() {
+			err := watcher.Watch(func() { c.notify(sensor) }, stop)
+			if err != nil && !polled {
+				logger.I().Warn("Unable to watch sensor, falling back to polling", "error", err)
+				c.unschedule(sensor)
+			} else if err != nil {
+				logger.I().Warn("Unable to watch sensor, only polling it", "error", err)
+			}
+		}()
+	}
 
-	c.collect()
+	if polled {
+		go func() {
+			ticker := time.NewTicker(poller.Interval())
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					c.notify(sensor)
+				}
+			}
+		}()
+	}
+}
 
+// setScheduled marks the sensor as scheduled and returns the channel that is
+// closed when it should no longer be.
+func (c *Collector) setScheduled(sensor SensorInterface) chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := make(chan struct{})
+	c.scheduled[sensor] = stop
+	return stop
+}
+
+// unschedule stops watching or polling the sensor.
+func (c *Collector) unschedule(sensor SensorInterface) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stop, ok := c.scheduled[sensor]; ok {
+		close(stop)
+		delete(c.scheduled, sensor)
+	}
+}
+
+// Reschedule picks up a changed interval of the sensor.
+func (c *Collector) Reschedule(sensor SensorInterface) {
+	c.mu.Lock()
+	running := c.running
+	c.mu.Unlock()
+	if running {
+		c.unschedule(sensor)
+		c.schedule(sensor)
+	}
+}
+
+// RemoveSensor stops collecting the sensor. It is not removed from Home
+// Assistant.
+func (c *Collector) RemoveSensor(sensor SensorInterface) {
+	c.unschedule(sensor)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, s := range c.Sensors {
+		if s == sensor {
+			c.Sensors = append(c.Sensors[:i], c.Sensors[i+1:]...)
+			break
+		}
+	}
+	for _, s := range sensor.GetSensors() {
+		delete(c.collected, s.UniqueID)
+		delete(c.lastSent, s.UniqueID)
+	}
+}
+
+// Reconfigure runs fn, which changes the settings of sensors, like their
+// name, icon or unique ID, while the collector isn't sending them.
+func (c *Collector) Reconfigure(fn func()) {
+	c.sensorMu.Lock()
+	defer c.sensorMu.Unlock()
+	fn()
+}
+
+// RetireSensor stops collecting the sensor and reports it as unavailable to
+// Home Assistant, for sensors whose device went away.
+func (c *Collector) RetireSensor(sensor SensorInterface) {
+	var updates []*SensorUpdate
+	c.sensorMu.Lock()
+	for _, s := range sensor.GetSensors() {
+		if !c.IsRegistered(s) || c.IsDisabled(s) {
+			continue
+		}
+		update := NewSensorUpdateFromSensor(s)
+		update.State = StateUnavailable
+		update.Attributes = nil
+		updates = append(updates, update)
+	}
+	c.sensorMu.Unlock()
+	c.RemoveSensor(sensor)
+	if len(updates) == 0 {
+		return
+	}
+	_, err := c.UpdateSensors(updates)
+	if err != nil {
+		logger.I().Error("Error marking sensors unavailable", "error", err)
+	}
+}
+
+// hasSensor reports whether the sensor is still collected.
+func (c *Collector) hasSensor(sensor SensorInterface) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.Sensors {
+		if s == sensor {
+			return true
+		}
+	}
+	return false
+}
+
+// MarkUnregistered makes the collector register the sensor again on the
+// next collection, for instance after its name or icon changed.
+func (c *Collector) MarkUnregistered(uniqueID string) {
+	c.setRegistered(uniqueID, false)
+	c.forget(uniqueID)
+}
+
+// polled returns the sensors that rely on the collector ticker.
+func (c *Collector) polled() []SensorInterface {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var polled []SensorInterface
+	for _, sensor := range c.Sensors {
+		if _, ok := c.scheduled[sensor]; !ok {
+			polled = append(polled, sensor)
+		}
+	}
+	return polled
+}
+
+// Collect sends all sensors to Home Assistant and keeps sending them until
+// Stop is called. Sensors implementing SensorWatcher are sent whenever they
+// report a change, sensors implementing SensorPoller on their own interval
+// and all others on the interval of the collector.
+func (c *Collector) Collect() {
 	c.StopChan = make(chan struct{})
 
+	c.mu.Lock()
+	all := append([]SensorInterface{}, c.Sensors...)
+	c.running = true
+	c.mu.Unlock()
+
+	c.collect(true, all...)
+	for _, sensor := range all {
+		c.schedule(sensor)
+	}
+
 	c.ticker = time.NewTicker(c.Interval)
 
+	var heartbeat <-chan time.Time
+	if c.Heartbeat > 0 {
+		t := time.NewTicker(c.Heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+
+	pending := map[SensorInterface]bool{}
+	var debounce <-chan time.Time
+
 	for {
 		select {
 		case <-c.StopChan:
 			logger.I().Info("Stopping collector")
 			c.ticker.Stop()
+			c.mu.Lock()
+			c.running = false
+			c.mu.Unlock()
 			logger.I().Info("Stopped collector")
 			return
+		case <-heartbeat:
+			c.mu.Lock()
+			all := append([]SensorInterface{}, c.Sensors...)
+			c.mu.Unlock()
+			// Sensors are updated on their own schedule, the heartbeat only
+			// repeats their current state.
+			c.send(true, all...)
 		case <-c.ticker.C:
-			c.collect()
+			c.collect(c.Heartbeat == 0, c.polled()...)
+		case sensor := <-c.updates:
+			pending[sensor] = true
+			if c.Debounce > 0 {
+				if debounce == nil {
+					debounce = time.After(c.Debounce)
+				}
+				continue
+			}
+			c.collect(false, sensor)
+			delete(pending, sensor)
+		case <-debounce:
+			debounce = nil
+			var changed []SensorInterface
+			for sensor := range pending {
+				if c.hasSensor(sensor) {
+					changed = append(changed, sensor)
+				}
+			}
+			pending = map[SensorInterface]bool{}
+			c.collect(false, changed...)
+		}
+	}
+}
+
+// changed reports whether the update differs from the last one sent for the
+// sensor, taking the threshold of the sensor into account.
+func (c *Collector) changed(sensor *Sensor, update *SensorUpdate) bool {
+	c.mu.Lock()
+	last, ok := c.lastSent[update.UniqueID]
+	c.mu.Unlock()
+	if !ok || last.Icon != update.Icon {
+		return true
+	}
+	if sensor.Threshold > 0 {
+		previous, okPrevious := toFloat(last.State)
+		current, okCurrent := toFloat(update.State)
+		if okPrevious && okCurrent {
+			return math.Abs(current-previous) >= sensor.Threshold
 		}
 	}
+	return !reflect.DeepEqual(last.State, update.State) ||
+		!reflect.DeepEqual(last.Attributes, update.Attributes)
+}
+
+// toFloat converts a numeric sensor state to a float64.
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// recordUpdateError keeps track of the result of updating the sensor. A
+// failed update makes the sensor unavailable, which is how the mobile_app
+// integration marks an entity unavailable, instead of leaving its last state.
+func (c *Collector) recordUpdateError(sensor *Sensor, err error) {
+	if err == nil {
+		if sensor.UpdateError != nil {
+			logger.I().Info("Sensor recovered", "sensor", sensor.UniqueID)
+			// The update left the error in place of the attributes
+			if msg, ok := sensor.Attributes["error"]; ok && msg == sensor.UpdateError.Error() {
+				sensor.Attributes = sensor.okAttributes
+			}
+		}
+		sensor.UpdateError = nil
+		sensor.okAttributes = nil
+		return
+	}
+	if sensor.UpdateError == nil || sensor.UpdateError.Error() != err.Error() {
+		logger.I().Warn("Failed to update sensor", "sensor", sensor.UniqueID, "error", err)
+	}
+	if sensor.UpdateError == nil {
+		sensor.okAttributes = sensor.Attributes
+	}
+	sensor.UpdateError = err
+	sensor.ErrorCount++
+	sensor.State = StateUnavailable
+	sensor.Attributes = map[string]any{
+		"error": err.Error(),
+	}
 }
 
-func (c *Collector) collect() {
-	logger.I().Info("Collecting sensors...")
+// forget drops the last sent update of a sensor, so it is sent again on the
+// next collection.
+func (c *Collector) forget(id string) {
+	c.mu.Lock()
+	delete(c.lastSent, id)
+	c.mu.Unlock()
+}
+
+// collect updates the given sensors and sends them to Home Assistant. Unless
+// force is set, only sensors that changed since they were last sent are
+// included.
+func (c *Collector) collect(force bool, sensors ...SensorInterface) {
+	if len(sensors) == 0 {
+		return
+	}
+	logger.I().Info("Collecting sensors...", "count", len(sensors))
+	for _, _sensors := range sensors {
+		err := _sensors.Update()
+		for _, sensor := range _sensors.GetSensors() {
+			c.recordUpdateError(sensor, err)
+		}
+	}
+	c.send(force, sensors...)
+}
+
+// send sends the current state of the given sensors to Home Assistant,
+// without updating them. Unless force is set, only sensors that changed
+// since they were last sent are included.
+func (c *Collector) send(force bool, sensors ...SensorInterface) {
 	var toUpdate []*SensorUpdate
-	for _, _sensors := range c.Sensors {
+	c.sensorMu.Lock()
+	for _, _sensors := range sensors {
 		s := _sensors.GetSensors()
 		for _, sensor := range s {
 			logger.I().Debug("Collecting sensor", "sensor", sensor.UniqueID)
-			if !c.IsRegistered(sensor) {
+			c.mu.Lock()
+			c.collected[sensor.UniqueID] = sensor
+			c.mu.Unlock()
+			if !c.registeredNow(sensor) {
 				_, err := c.RegisterSensor(sensor)
-				if err == nil {
-					c.RegisteredSensors = append(c.RegisteredSensors, sensor.UniqueID)
+				if err != nil {
+					logger.I().Error("Failed to register sensor", "sensor", sensor.UniqueID, "error", err)
+				} else {
+					c.setRegistered(sensor.UniqueID, true)
 				}
 			}
-			if !c.IsDisabled(sensor) {
-				toUpdate = append(toUpdate, NewSensorUpdateFromSensor(sensor))
+			// Disabled sensors are only sent along with a full update, so
+			// Home Assistant can tell us when they are enabled again.
+			if c.IsDisabled(sensor) && !force {
+				continue
+			}
+			update := NewSensorUpdateFromSensor(sensor)
+			if force || c.changed(sensor, update) {
+				toUpdate = append(toUpdate, update)
 			}
 		}
 	}
-	_, err := c.UpdateSensors(toUpdate)
+	c.sensorMu.Unlock()
+	if len(toUpdate) == 0 {
+		return
+	}
+	body, err := c.UpdateSensors(toUpdate)
 	if err != nil {
 		logger.I().Error("Error updating sensors", "error", err)
+		return
 	}
+	c.mu.Lock()
+	for _, update := range toUpdate {
+		c.lastSent[update.UniqueID] = update
+	}
+	c.mu.Unlock()
+	response, err := ParseSensorUpdateResponse(body)
+	if err != nil {
+		logger.I().Error("Failed to decode sensor update response", "error", err, "body", string(body))
+		return
+	}
+	c.HandleUpdateResponse(response)
 }
 
 func (c *Collector) Stop() {
+	c.mu.Lock()
+	for sensor, stop := range c.scheduled {
+		close(stop)
+		delete(c.scheduled, sensor)
+	}
+	c.mu.Unlock()
 	close(c.StopChan)
 
 }
@@ -190,6 +806,9 @@ func (c *Collector) RegisterSensor(sensor *Sensor) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if r.IsError() {
+		return nil, fmt.Errorf("Error registering sensor %s: %v", sensor.UniqueID, r.Status())
+	}
 	return r.Body(), err
 }
 
@@ -201,6 +820,9 @@ func (c *Collector) UpdateSensors(sensors []*SensorUpdate) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	if r.IsError() {
+		return nil, fmt.Errorf("Error updating sensors: %v", r.Status())
+	}
 
 	return r.Body(), err
 }
@@ -0,0 +1,62 @@
+package sensors
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRecordUpdateError(t *testing.T) {
+	c := NewCollector("", 0)
+	failed := errors.New("device went away")
+
+	tests := []struct {
+		name string
+		// update changes the sensor like its Update would on success
+		update func(s *Sensor)
+		want   map[string]any
+	}{
+		{
+			name:   "attributes kept by the update",
+			update: func(s *Sensor) { s.State = 42 },
+			want:   map[string]any{"device": "BAT0"},
+		},
+		{
+			name: "attributes set by the update",
+			update: func(s *Sensor) {
+				s.State = 42
+				s.Attributes = map[string]any{"device": "BAT1"}
+			},
+			want: map[string]any{"device": "BAT1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Sensor{State: 40, Attributes: map[string]any{"device": "BAT0"}}
+
+			c.recordUpdateError(s, failed)
+			c.recordUpdateError(s, failed)
+			if s.State != StateUnavailable {
+				t.Errorf("state after failing = %v, want %v", s.State, StateUnavailable)
+			}
+			if s.Attributes["error"] != failed.Error() {
+				t.Errorf("error attribute = %v, want %v", s.Attributes["error"], failed.Error())
+			}
+			if s.ErrorCount != 2 {
+				t.Errorf("error count = %d, want 2", s.ErrorCount)
+			}
+
+			tt.update(s)
+			c.recordUpdateError(s, nil)
+			if s.UpdateError != nil {
+				t.Errorf("update error after recovering = %v, want nil", s.UpdateError)
+			}
+			if s.State != 42 {
+				t.Errorf("state after recovering = %v, want 42", s.State)
+			}
+			if !reflect.DeepEqual(s.Attributes, tt.want) {
+				t.Errorf("attributes after recovering = %v, want %v", s.Attributes, tt.want)
+			}
+		})
+	}
+}
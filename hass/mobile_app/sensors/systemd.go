@@ -0,0 +1,225 @@
+package sensors
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdDest    = "org.freedesktop.systemd1"
+	systemdPath    = "/org/freedesktop/systemd1"
+	systemdManager = "org.freedesktop.systemd1.Manager"
+	systemdUnit    = "org.freedesktop.systemd1.Unit"
+)
+
+// Unit reports the state of a systemd unit, or the number of failed units,
+// of the system or the user service manager.
+type Unit struct {
+	Sensor
+	conn *dbus.Conn
+	// Unit name and object path, empty for the failed units sensor
+	unit string
+	path dbus.ObjectPath
+}
+
+func (u *Unit) GetSensors() []*Sensor {
+	return []*Sensor{&u.Sensor}
+}
+
+func (u *Unit) Enable() {
+	u.Sensor.Disabled = false
+}
+
+func (u *Unit) Disable() {
+	u.Sensor.Disabled = true
+}
+
+func (u *Unit) Update() error {
+	if u.unit == "" {
+		failed, err := u.conn.Object(systemdDest, systemdPath).GetProperty(systemdManager + ".NFailedUnits")
+		if err != nil {
+			return err
+		}
+		u.State, _ = failed.Value().(uint32)
+		return nil
+	}
+
+	o := u.conn.Object(systemdDest, u.path)
+	active, err := o.GetProperty(systemdUnit + ".ActiveState")
+	if err != nil {
+		return err
+	}
+	u.State, _ = active.Value().(string)
+	u.Attributes = map[string]any{
+		"unit":        u.unit,
+		"sub_state":   stringProperty(o, systemdUnit+".SubState"),
+		"load_state":  stringProperty(o, systemdUnit+".LoadState"),
+		"description": stringProperty(o, systemdUnit+".Description"),
+	}
+	return nil
+}
+
+// Watch follows the PropertiesChanged signals of the units and calls notify
+// when the state of this unit, or of any unit for the failed units sensor,
+// changes.
+func (u *Unit) Watch(notify func(), stop <-chan struct{}) error {
+	// systemd only sends unit signals to subscribed clients. Subscribing
+	// twice on a connection fails, which is fine.
+	u.conn.Object(systemdDest, systemdPath).Call(systemdManager+".Subscribe", 0)
+
+	options := []dbus.MatchOption{
+		dbus.WithMatchSender(systemdDest),
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchMember("PropertiesChanged"),
+	}
+	if u.unit != "" {
+		options = append(options, dbus.WithMatchObjectPath(u.path))
+	}
+	err := u.conn.AddMatchSignal(options...)
+	if err != nil {
+		return err
+	}
+	defer u.conn.RemoveMatchSignal(options...)
+
+	c := make(chan *dbus.Signal, 10)
+	u.conn.Signal(c)
+	defer u.conn.RemoveSignal(c)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case v, ok := <-c:
+			if !ok {
+				return nil
+			}
+			if v.Name != "org.freedesktop.DBus.Properties.PropertiesChanged" || len(v.Body) < 2 {
+				continue
+			}
+			if u.unit != "" && v.Path != u.path {
+				continue
+			}
+			if !strings.HasPrefix(string(v.Path), systemdPath+"/unit/") {
+				continue
+			}
+			if iface, _ := v.Body[0].(string); iface != systemdUnit {
+				continue
+			}
+			changed, _ := v.Body[1].(map[string]dbus.Variant)
+			_, active := changed["ActiveState"]
+			_, sub := changed["SubState"]
+			if active || (sub && u.unit != "") {
+				notify()
+			}
+		}
+	}
+}
+
+// hasGlob reports whether a unit pattern is a glob instead of a name.
+func hasGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// findUnits returns the object paths of the units matching the patterns, by
+// unit name. Units matching a glob are only found while loaded, units given
+// by name are loaded when needed.
+func findUnits(conn *dbus.Conn, patterns []string) (map[string]dbus.ObjectPath, error) {
+	manager := conn.Object(systemdDest, systemdPath)
+	units := map[string]dbus.ObjectPath{}
+
+	globs := []string{}
+	for _, pattern := range patterns {
+		if hasGlob(pattern) {
+			globs = append(globs, pattern)
+			continue
+		}
+		var path dbus.ObjectPath
+		// Invalid unit names fail to load, units that don't exist load as
+		// not-found.
+		err := manager.Call(systemdManager+".LoadUnit", 0, pattern).Store(&path)
+		if err == nil {
+			units[pattern] = path
+		}
+	}
+	if len(globs) == 0 {
+		return units, nil
+	}
+
+	var listed []struct {
+		Name        string
+		Description string
+		LoadState   string
+		ActiveState string
+		SubState    string
+		Following   string
+		Path        dbus.ObjectPath
+		JobID       uint32
+		JobType     string
+		JobPath     dbus.ObjectPath
+	}
+	err := manager.Call(systemdManager+".ListUnitsByPatterns", 0, []string{}, globs).Store(&listed)
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range listed {
+		units[unit.Name] = unit.Path
+	}
+	return units, nil
+}
+
+// DiscoverUnits creates a failed units sensor for the system or the user
+// service manager on conn, and a sensor for each unit matching one of the
+// patterns, like docker.service or gitlab-runner@*.service.
+func DiscoverUnits(conn *dbus.Conn, user bool, patterns []string) ([]*Unit, error) {
+	prefix, scope := "systemd_", ""
+	if user {
+		prefix, scope = "systemd_user_", "user "
+	}
+
+	failed := &Unit{
+		Sensor: Sensor{
+			Name:       "Failed " + scope + "units",
+			UniqueID:   prefix + "failed_units",
+			Type:       "sensor",
+			Icon:       "mdi:alert-circle-outline",
+			StateClass: "measurement",
+		},
+		conn: conn,
+	}
+	err := failed.Update()
+	if err != nil {
+		return nil, err
+	}
+
+	units, err := findUnits(conn, patterns)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	found := []*Unit{failed}
+	for _, name := range names {
+		unit := &Unit{
+			Sensor: Sensor{
+				Name:     "Unit " + name,
+				UniqueID: prefix + slug(name),
+				Type:     "sensor",
+				Icon:     "mdi:cog-play",
+			},
+			conn: conn,
+			unit: name,
+			path: units[name],
+		}
+		if err := unit.Update(); err != nil {
+			return nil, err
+		}
+		found = append(found, unit)
+	}
+	return found, nil
+}
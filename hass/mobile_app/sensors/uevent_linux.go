@@ -0,0 +1,68 @@
+package sensors
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// WatchDevices listens for the kernel announcing devices being added or
+// removed, and calls notify with the action and subsystem of each, like add
+// and power_supply, until stop is closed.
+func WatchDevices(notify func(action, subsystem string), stop <-chan struct{}) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return fmt.Errorf("uevent socket: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	// Group 1 receives the events of the kernel, without waiting for udev
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1})
+	if err != nil {
+		return fmt.Errorf("uevent bind: %v", err)
+	}
+	// Wake up every second to see whether to stop
+	err = syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &syscall.Timeval{Sec: 1})
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 16*1024)
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		n, _, err := syscall.Recvfrom(fd, buf, 0)
+		if err == syscall.EAGAIN || err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("uevent receive: %v", err)
+		}
+		action, subsystem := parseUevent(buf[:n])
+		if action == "add" || action == "remove" {
+			notify(action, subsystem)
+		}
+	}
+}
+
+// parseUevent returns the action and subsystem of a kernel uevent, which is
+// a header like add@/devices/... followed by KEY=value fields, separated by
+// NUL bytes.
+func parseUevent(msg []byte) (action, subsystem string) {
+	for _, field := range strings.Split(string(msg), "\x00") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "ACTION":
+			action = value
+		case "SUBSYSTEM":
+			subsystem = value
+		}
+	}
+	return action, subsystem
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package sensors
+
+import "errors"
+
+// WatchDevices is only supported on Linux.
+func WatchDevices(notify func(action, subsystem string), stop <-chan struct{}) error {
+	return errors.New("device events are only supported on Linux")
+}
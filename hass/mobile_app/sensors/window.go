@@ -0,0 +1,419 @@
+package sensors
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// windowInfo describes the focused window.
+type windowInfo struct {
+	Application string
+	Title       string
+	PID         int
+}
+
+// activeWindowFunc returns the focused window, or nil when no window has
+// focus.
+type activeWindowFunc func() (*windowInfo, error)
+
+// ActiveWindow reports the application of the focused window, with its
+// title and process ID as attributes. When private, only the application is
+// reported.
+type ActiveWindow struct {
+	Sensor
+	active   activeWindowFunc
+	private  bool
+	interval time.Duration
+}
+
+func (w *ActiveWindow) GetSensors() []*Sensor {
+	return []*Sensor{&w.Sensor}
+}
+
+func (w *ActiveWindow) Enable() {
+	w.Sensor.Disabled = false
+}
+
+func (w *ActiveWindow) Disable() {
+	w.Sensor.Disabled = true
+}
+
+// Interval returns how often the sensor is polled.
+func (w *ActiveWindow) Interval() time.Duration {
+	return w.interval
+}
+
+// SetInterval changes how often the sensor is polled.
+func (w *ActiveWindow) SetInterval(interval time.Duration) {
+	w.interval = interval
+}
+
+// SetPrivate makes the sensor leave out the window title and process ID.
+func (w *ActiveWindow) SetPrivate(private bool) {
+	w.private = private
+}
+
+func (w *ActiveWindow) Update() error {
+	window, err := w.active()
+	if err != nil {
+		return err
+	}
+	if window == nil {
+		w.State = StateUnavailable
+		w.Attributes = nil
+		return nil
+	}
+
+	application := window.Application
+	if application == "" && window.PID > 0 {
+		application = readSysfsString(fmt.Sprintf("/proc/%d/comm", window.PID))
+	}
+	w.State = application
+	w.Attributes = nil
+	if !w.private {
+		w.Attributes = map[string]any{
+			"title": window.Title,
+			"pid":   window.PID,
+		}
+	}
+	return nil
+}
+
+func runWindowCommand(name string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return out, nil
+}
+
+// swayNode is a node of the tree of swaymsg -t get_tree.
+type swayNode struct {
+	Name             string     `json:"name"`
+	Focused          bool       `json:"focused"`
+	PID              int        `json:"pid"`
+	AppID            string     `json:"app_id"`
+	Nodes            []swayNode `json:"nodes"`
+	FloatingNodes    []swayNode `json:"floating_nodes"`
+	WindowProperties struct {
+		Class string `json:"class"`
+	} `json:"window_properties"`
+}
+
+func (n *swayNode) focused() *swayNode {
+	if n.Focused && n.PID > 0 {
+		return n
+	}
+	for _, children := range [][]swayNode{n.Nodes, n.FloatingNodes} {
+		for i := range children {
+			if found := children[i].focused(); found != nil {
+				return found
+			}
+		}
+	}
+	return nil
+}
+
+// swayActiveWindow asks sway, or i3, for the focused window.
+func swayActiveWindow() (*windowInfo, error) {
+	out, err := runWindowCommand("swaymsg", "-t", "get_tree", "-r")
+	if err != nil {
+		return nil, err
+	}
+	var tree swayNode
+	if err := json.Unmarshal(out, &tree); err != nil {
+		return nil, err
+	}
+	node := tree.focused()
+	if node == nil {
+		return nil, nil
+	}
+	application := node.AppID
+	if application == "" {
+		application = node.WindowProperties.Class
+	}
+	return &windowInfo{Application: application, Title: node.Name, PID: node.PID}, nil
+}
+
+// hyprlandActiveWindow asks Hyprland for the focused window.
+func hyprlandActiveWindow() (*windowInfo, error) {
+	out, err := runWindowCommand("hyprctl", "activewindow", "-j")
+	if err != nil {
+		return nil, err
+	}
+	var window struct {
+		Class string `json:"class"`
+		Title string `json:"title"`
+		PID   int    `json:"pid"`
+	}
+	if err := json.Unmarshal(out, &window); err != nil {
+		// hyprctl prints "Invalid" when no window has focus
+		return nil, nil
+	}
+	if window.PID <= 0 {
+		return nil, nil
+	}
+	return &windowInfo{Application: window.Class, Title: window.Title, PID: window.PID}, nil
+}
+
+// gnomeActiveWindow asks GNOME Shell for the focused window. GNOME doesn't
+// offer this to other applications, so it needs the Window Calls extension.
+func gnomeActiveWindow(conn *dbus.Conn) activeWindowFunc {
+	return func() (*windowInfo, error) {
+		o := conn.Object("org.gnome.Shell", "/org/gnome/Shell/Extensions/Windows")
+		var list string
+		err := o.Call("org.gnome.Shell.Extensions.Windows.List", 0).Store(&list)
+		if err != nil {
+			return nil, err
+		}
+		var windows []struct {
+			ID      uint32 `json:"id"`
+			WMClass string `json:"wm_class"`
+			PID     int    `json:"pid"`
+			Focus   bool   `json:"focus"`
+			Title   string `json:"title"`
+		}
+		if err := json.Unmarshal([]byte(list), &windows); err != nil {
+			return nil, err
+		}
+		for _, window := range windows {
+			if !window.Focus {
+				continue
+			}
+			title := window.Title
+			if title == "" {
+				// Newer versions of the extension only list the title on
+				// request.
+				o.Call("org.gnome.Shell.Extensions.Windows.GetTitle", 0, window.ID).Store(&title)
+			}
+			return &windowInfo{Application: window.WMClass, Title: title, PID: window.PID}, nil
+		}
+		return nil, nil
+	}
+}
+
+const (
+	kwinDest          = "org.kde.KWin"
+	kwinScriptingPath = "/Scripting"
+	kwinScripting     = "org.kde.kwin.Scripting"
+	kwinScriptName    = "hass_companion_active_window"
+	kwinWindowPath    = "/be/subutux/companion/ActiveWindow"
+	kwinWindowIface   = "be.subutux.companion.ActiveWindow"
+)
+
+// kwinScript follows window activation and title changes in KWin and calls
+// SetWindow of kwinWindowIface on the companion with the focused window.
+// KWin 6 renamed clients to windows, KWin 5 only knows the former.
+const kwinScript = `
+var current = null;
+function activeWindow() {
+	return workspace.activeWindow !== undefined ? workspace.activeWindow : workspace.activeClient;
+}
+function report() {
+	var window = activeWindow();
+	if (!window) {
+		callDBus(%[1]q, %[2]q, %[3]q, "SetWindow", "", "", "0");
+		return;
+	}
+	callDBus(%[1]q, %[2]q, %[3]q, "SetWindow",
+		String(window.resourceClass), String(window.caption), String(window.pid));
+}
+function activated(window) {
+	if (current) {
+		current.captionChanged.disconnect(report);
+	}
+	current = window;
+	if (current) {
+		current.captionChanged.connect(report);
+	}
+	report();
+}
+(workspace.windowActivated || workspace.clientActivated).connect(activated);
+activated(activeWindow());
+`
+
+// kwinWindow keeps the focused window as reported by kwinScript. KWin
+// doesn't tell other applications which window has focus, but its scripts
+// can.
+type kwinWindow struct {
+	mu     sync.Mutex
+	window *windowInfo
+}
+
+// SetWindow is called by kwinScript over D-Bus.
+func (k *kwinWindow) SetWindow(application, title, pid string) *dbus.Error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.window = nil
+	if application == "" && title == "" {
+		return nil
+	}
+	k.window = &windowInfo{Application: application, Title: title}
+	k.window.PID, _ = strconv.Atoi(pid)
+	return nil
+}
+
+func (k *kwinWindow) active() (*windowInfo, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.window == nil {
+		return nil, nil
+	}
+	window := *k.window
+	return &window, nil
+}
+
+// kwinActiveWindow loads kwinScript into KWin, replacing the one of an
+// earlier run, and returns the focused window it reports.
+func kwinActiveWindow(conn *dbus.Conn) (activeWindowFunc, error) {
+	names := conn.Names()
+	if len(names) == 0 {
+		return nil, errors.New("no name on the session bus")
+	}
+	k := &kwinWindow{}
+	err := conn.Export(k, kwinWindowPath, kwinWindowIface)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.CreateTemp("", "hass-companion-kwin-*.js")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(file.Name())
+	_, err = fmt.Fprintf(file, kwinScript, names[0], kwinWindowPath, kwinWindowIface)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scripting := conn.Object(kwinDest, kwinScriptingPath)
+	scripting.Call(kwinScripting+".unloadScript", 0, kwinScriptName)
+	var id int32
+	err = scripting.Call(kwinScripting+".loadScript", 0, file.Name(), kwinScriptName).Store(&id)
+	if err != nil {
+		return nil, fmt.Errorf("loading KWin script: %v", err)
+	}
+	// KWin 6 serves the script on /Scripting/Script<id>, KWin 5 on /<id>
+	for _, path := range []string{fmt.Sprintf("/Scripting/Script%d", id), fmt.Sprintf("/%d", id)} {
+		err = conn.Object(kwinDest, dbus.ObjectPath(path)).Call("org.kde.kwin.Script.run", 0).Err
+		if err == nil {
+			return k.active, nil
+		}
+	}
+	return nil, fmt.Errorf("running KWin script: %v", err)
+}
+
+var (
+	xpropWindowID = regexp.MustCompile(`window id # (0x[0-9a-f]+)`)
+	xpropString   = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"`)
+)
+
+// x11ActiveWindow reads _NET_ACTIVE_WINDOW of the root window, and the
+// title, class and process of that window, with xprop.
+func x11ActiveWindow() (*windowInfo, error) {
+	out, err := runWindowCommand("xprop", "-root", "_NET_ACTIVE_WINDOW")
+	if err != nil {
+		return nil, err
+	}
+	match := xpropWindowID.FindStringSubmatch(string(out))
+	if match == nil || match[1] == "0x0" {
+		return nil, nil
+	}
+
+	out, err = runWindowCommand("xprop", "-id", match[1], "_NET_WM_NAME", "WM_CLASS", "_NET_WM_PID")
+	if err != nil {
+		return nil, err
+	}
+	window := &windowInfo{}
+	for _, line := range strings.Split(string(out), "\n") {
+		property, value, ok := strings.Cut(line, " = ")
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(property, "_NET_WM_NAME"):
+			if m := xpropString.FindStringSubmatch(value); m != nil {
+				window.Title = m[1]
+			}
+		case strings.HasPrefix(property, "WM_CLASS"):
+			// WM_CLASS(STRING) = "instance", "Class"
+			if m := xpropString.FindAllStringSubmatch(value, -1); len(m) > 0 {
+				window.Application = m[len(m)-1][1]
+			}
+		case strings.HasPrefix(property, "_NET_WM_PID"):
+			window.PID, _ = strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	return window, nil
+}
+
+// findActiveWindowFunc picks the way to find the focused window for the
+// desktop the companion runs in. Supported are sway and i3, Hyprland, GNOME
+// with the Window Calls extension, KDE Plasma and other X11 desktops. Other
+// Wayland compositors, like labwc, wayfire or river, don't offer it.
+func findActiveWindowFunc(sessiondbus *dbus.Conn) (activeWindowFunc, error) {
+	desktop := strings.ToLower(os.Getenv("XDG_CURRENT_DESKTOP"))
+	wayland := os.Getenv("WAYLAND_DISPLAY") != ""
+	switch {
+	case os.Getenv("SWAYSOCK") != "" || os.Getenv("I3SOCK") != "":
+		return swayActiveWindow, nil
+	case os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") != "":
+		return hyprlandActiveWindow, nil
+	case strings.Contains(desktop, "gnome") && sessiondbus != nil:
+		return gnomeActiveWindow(sessiondbus), nil
+	case strings.Contains(desktop, "kde") && sessiondbus != nil:
+		active, err := kwinActiveWindow(sessiondbus)
+		if err != nil && !wayland && os.Getenv("DISPLAY") != "" {
+			return x11ActiveWindow, nil
+		}
+		return active, err
+	case !wayland && os.Getenv("DISPLAY") != "":
+		return x11ActiveWindow, nil
+	}
+	// On other Wayland compositors xprop only sees X11 applications
+	if desktop == "" {
+		desktop = "this desktop"
+	}
+	return nil, fmt.Errorf("finding the active window isn't supported on %s, only on sway, i3, Hyprland, GNOME, KDE Plasma and X11", desktop)
+}
+
+// DiscoverActiveWindow creates the active window sensor when the desktop
+// tells which window has focus.
+func DiscoverActiveWindow(sessiondbus *dbus.Conn, private bool) (*ActiveWindow, error) {
+	active, err := findActiveWindowFunc(sessiondbus)
+	if err != nil {
+		return nil, err
+	}
+	window := &ActiveWindow{
+		Sensor: Sensor{
+			Name:     "Active window",
+			UniqueID: "active_window",
+			Type:     "sensor",
+			Icon:     "mdi:application",
+		},
+		active:   active,
+		private:  private,
+		interval: 5 * time.Second,
+	}
+	err = window.Update()
+	if err != nil {
+		return nil, err
+	}
+	return window, nil
+}
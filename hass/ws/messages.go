@@ -81,11 +81,36 @@ type IncomingPushNotificationMessage struct {
 				Title  string `json:"title"`
 				Uri    string `json:"uri"`
 			} `json:"actions"`
+			// Set for notification commands, like command_media
+			Command          CommandValue `json:"command"`
+			MediaCommand     string       `json:"media_command"`
+			MediaPackageName string       `json:"media_package_name"`
 		} `json:"data"`
 		HassConfirmId string `json:"hass_confirm_id"`
 	} `json:"event"`
 }
 
+// CommandValue is the command argument of a notification command. Home
+// Assistant sends it as a string, a number or a boolean depending on the
+// command, so any of those are decoded as text.
+type CommandValue string
+
+func (c *CommandValue) UnmarshalJSON(data []byte) error {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*c = ""
+	case string:
+		*c = CommandValue(v)
+	default:
+		*c = CommandValue(bytes.TrimSpace(data))
+	}
+	return nil
+}
+
 func IncomingPushNotificationMessageFromJSON(data []byte) (*IncomingPushNotificationMessage, error) {
 	var msg IncomingPushNotificationMessage
 	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"os"
 	"path"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
 	"github.com/subutux/hass_companion/hass/auth"
@@ -44,6 +48,14 @@ func Get(conf string) string {
 	return viper.GetString(conf)
 }
 
+func IsSet(conf string) bool {
+	return viper.IsSet(conf)
+}
+
+func GetDuration(conf string) time.Duration {
+	return viper.GetDuration(conf)
+}
+
 func GetStruct(conf string, v interface{}) (interface{}, error) {
 	data := viper.GetString(conf)
 	err := json.Unmarshal([]byte(data), &v)
@@ -57,3 +69,211 @@ func Save() error {
 func NewCredentialsFromConfig() auth.Credentials {
 	return auth.NewCredentials(Get("server"), Get("auth.clientId"), Get("auth.accessToken"), Get("auth.refreshToken"))
 }
+
+// SensorConfig holds the settings of a sensor in the sensors section of the
+// config file. Sensors are configured by the name of the built-in sensor
+// (battery, memory, load, ...), and can be overridden per unique ID.
+//
+//	sensors:
+//	  load:
+//	    enabled: false
+//	  memory:
+//	    interval: 2m
+//	    threshold: 1
+//	  battery_bat0_level:
+//	    name: Laptop battery
+//	  disk:
+//	    exclude: ["/boot/*"]
+//	  window:
+//	    private: true
+//	  bluetooth:
+//	    include: ["WH-1000XM4", "AA:BB:CC:DD:EE:FF"]
+//	  systemd:
+//	    include: ["docker.service", "gitlab-runner@*.service"]
+//	  containers:
+//	    include: ["postgres", "dev-*"]
+//
+// Unique IDs start with the namespace of the built-in sensor, like
+// battery_bat0_level. Overrides of the IDs of earlier releases, like
+// bat0_level, keep working.
+//
+// Include and exclude select what sensors like disk discover, by patterns
+// that depend on the sensor. Private makes sensors like window leave out
+// personal data.
+type SensorConfig struct {
+	Enabled   *bool         `mapstructure:"enabled"`
+	Interval  time.Duration `mapstructure:"interval"`
+	Name      string        `mapstructure:"name"`
+	Icon      string        `mapstructure:"icon"`
+	Threshold float64       `mapstructure:"threshold"`
+	Include   []string      `mapstructure:"include"`
+	Exclude   []string      `mapstructure:"exclude"`
+	Private   *bool         `mapstructure:"private"`
+}
+
+// IsPrivate reports whether the sensor should leave out personal data.
+func (s SensorConfig) IsPrivate() bool {
+	return s.Private != nil && *s.Private
+}
+
+// IsEnabled reports whether the sensor is enabled, which is the default.
+func (s SensorConfig) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// merge returns s with the fields set in o overridden.
+func (s SensorConfig) merge(o SensorConfig) SensorConfig {
+	if o.Enabled != nil {
+		s.Enabled = o.Enabled
+	}
+	if o.Interval != 0 {
+		s.Interval = o.Interval
+	}
+	if o.Name != "" {
+		s.Name = o.Name
+	}
+	if o.Icon != "" {
+		s.Icon = o.Icon
+	}
+	if o.Threshold != 0 {
+		s.Threshold = o.Threshold
+	}
+	if o.Include != nil {
+		s.Include = o.Include
+	}
+	if o.Exclude != nil {
+		s.Exclude = o.Exclude
+	}
+	if o.Private != nil {
+		s.Private = o.Private
+	}
+	return s
+}
+
+// Sensor returns the configuration for the given names, later names
+// overriding the settings of earlier ones.
+func Sensor(names ...string) SensorConfig {
+	configs := map[string]SensorConfig{}
+	err := viper.UnmarshalKey("sensors", &configs)
+	if err != nil {
+		logger.I().Error("Invalid sensors configuration", "error", err)
+	}
+	var conf SensorConfig
+	for _, name := range names {
+		// viper keys are case insensitive
+		if c, ok := configs[strings.ToLower(name)]; ok {
+			conf = conf.merge(c)
+		}
+	}
+	return conf
+}
+
+// CommandSensorConfig configures a sensor that takes its state from the
+// output of a shell command, in the commands section of the config file.
+//
+//	commands:
+//	  - name: Build queue
+//	    command: /usr/local/bin/queue-length
+//	    interval: 1m
+//	    timeout: 5s
+//	    unit_of_measurement: jobs
+//	    state_class: measurement
+type CommandSensorConfig struct {
+	Name              string        `mapstructure:"name"`
+	UniqueID          string        `mapstructure:"unique_id"`
+	Command           string        `mapstructure:"command"`
+	Type              string        `mapstructure:"type"`
+	Interval          time.Duration `mapstructure:"interval"`
+	Timeout           time.Duration `mapstructure:"timeout"`
+	Icon              string        `mapstructure:"icon"`
+	DeviceClass       string        `mapstructure:"device_class"`
+	UnitOfMeasurement string        `mapstructure:"unit_of_measurement"`
+	StateClass        string        `mapstructure:"state_class"`
+	EntityCategory    string        `mapstructure:"entity_category"`
+}
+
+// ID returns the unique ID of the command sensor, derived from its name
+// when not configured.
+func (c CommandSensorConfig) ID() string {
+	if c.UniqueID != "" {
+		return c.UniqueID
+	}
+	id := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(c.Name))
+	return "command_" + id
+}
+
+// CommandSensors returns the configured command sensors.
+func CommandSensors() []CommandSensorConfig {
+	commands := []CommandSensorConfig{}
+	err := viper.UnmarshalKey("commands", &commands)
+	if err != nil {
+		logger.I().Error("Invalid commands configuration", "error", err)
+	}
+	return commands
+}
+
+var watchOnce sync.Once
+
+// OnChange calls fn whenever the config file changes on disk. Only the last
+// registered function is called.
+func OnChange(fn func()) {
+	viper.OnConfigChange(func(e fsnotify.Event) {
+		logger.I().Info("config changed", "file", e.Name)
+		fn()
+	})
+	watchOnce.Do(viper.WatchConfig)
+}
+
+// SensorRegistry records the sensors registered with Home Assistant, and
+// the version of the unique ID scheme they were registered with. It is kept
+// in a file next to the config file, so saving it doesn't count as a config
+// change.
+type SensorRegistry struct {
+	Version    int      `json:"version"`
+	Registered []string `json:"registered"`
+	Disabled   []string `json:"disabled"`
+}
+
+var registryMu sync.Mutex
+
+func registryFile() string {
+	return path.Join(path.Dir(viper.ConfigFileUsed()), "hass_companion_sensors.json")
+}
+
+// LoadSensorRegistry reads the sensor registry. Without one, it returns an
+// empty registry of version 0.
+func LoadSensorRegistry() (SensorRegistry, error) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry := SensorRegistry{}
+	data, err := os.ReadFile(registryFile())
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, err
+	}
+	err = json.Unmarshal(data, &registry)
+	return registry, err
+}
+
+// SaveSensorRegistry writes the sensor registry.
+func SaveSensorRegistry(registry SensorRegistry) error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	data, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := registryFile()
+	err = os.WriteFile(file+".tmp", data, 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
@@ -41,6 +41,22 @@ func (m *MainContent) AppendSensor(sensor sensors.SensorInterface) {
 	m.viewsList.Reload()
 }
 
+func (m *MainContent) RemoveSensor(sensor sensors.SensorInterface) {
+	for i, s := range m.sensors {
+		if s != sensor {
+			continue
+		}
+		m.sensors = append(m.sensors[:i], m.sensors[i+1:]...)
+		id := sensor.GetSensors()[0].UniqueID
+		if idx := Index(m.viewNames, id); idx != -1 {
+			m.viewNames = append(m.viewNames[:idx], m.viewNames[idx+1:]...)
+		}
+		delete(m.views, id)
+		m.viewsList.Reload()
+		return
+	}
+}
+
 func (m *MainContent) ResetSensors() {
 	m.sensors = []sensors.SensorInterface{}
 	m.viewNames = []string{"status"}
@@ -47,5 +47,28 @@ func (s SensorView) Container() fyne.CanvasObject {
 	dValue := widget.NewLabel(fmt.Sprintf("%v", sensor.Disabled))
 	disabled := container.NewHBox(dTitle, dValue)
 
-	return container.NewVBox(mainTitle, title, Type, DeviceClass, state, disabled)
+	content := container.NewVBox(mainTitle, title, Type, DeviceClass, state, disabled)
+
+	if sensor.LastError != nil {
+		eTitle := widget.NewLabel("Error")
+		eTitle.TextStyle.Bold = true
+		eValue := widget.NewLabel(sensor.LastError.Error())
+		content.Add(container.NewHBox(eTitle, eValue))
+	}
+
+	if sensor.UpdateError != nil {
+		uTitle := widget.NewLabel("Update error")
+		uTitle.TextStyle.Bold = true
+		uValue := widget.NewLabel(sensor.UpdateError.Error())
+		content.Add(container.NewHBox(uTitle, uValue))
+	}
+
+	if sensor.ErrorCount > 0 {
+		cTitle := widget.NewLabel("Failed updates")
+		cTitle.TextStyle.Bold = true
+		cValue := widget.NewLabel(fmt.Sprintf("%d", sensor.ErrorCount))
+		content.Add(container.NewHBox(cTitle, cValue))
+	}
+
+	return content
 }
@@ -110,7 +110,7 @@ func Start(hass *ws.Client, status *ui.StatusContent, main *ui.MainContent, clos
 		hass.SendCommand(ws.NewSubscribeToEvents("state_changed"))
 
 		// SetupMobile
-		mobile, err := SetupMobile(*hass.Credentials, main)
+		mobile, stop, err := SetupMobile(*hass.Credentials, main)
 		if err != nil {
 			logger.I().Error("Failed to setup mobile", "error", err)
 			a.Quit()
@@ -140,6 +140,7 @@ func Start(hass *ws.Client, status *ui.StatusContent, main *ui.MainContent, clos
 
 				status.SetStatus(ui.StatusDisconnecting, "Failed to receive a pong in time.")
 				mobile.SensorCollector.Stop()
+				close(stop)
 				main.ResetSensors()
 				logger.I().Warn("Trying redial")
 				var hassErr error
@@ -201,22 +202,29 @@ func Connect(creds auth.Credentials) *ws.Client {
 	return hass
 }
 
-func SetupMobile(creds auth.Credentials, content *ui.MainContent) (*mobile_app.MobileApp, error) {
+// SetupMobile registers the companion with Home Assistant when needed and
+// starts collecting sensors. The returned channel is to be closed, along
+// with stopping the collector, to stop watching for devices.
+func SetupMobile(creds auth.Credentials, content *ui.MainContent) (*mobile_app.MobileApp, chan struct{}, error) {
 	rhass := rest.NewClient(&creds)
 	var registration *rest.RegistrationResponse
 	// Load registration from config if exists
 	reg, err := config.GetStruct("registration", registration)
+	newRegistration := err != nil
 	if err != nil {
 		// Else, register a new
 		reg = mobile_app.NewMobileAppRegistration()
 		registration, err = rhass.RegisterMobileApp(reg)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		config.Set("registration", registration)
 	}
 
 	mobile := mobile_app.NewMobileApp(registration, &creds, hass, 60*time.Second)
+	if config.IsSet("collector.heartbeat") {
+		mobile.SensorCollector.Heartbeat = config.GetDuration("collector.heartbeat")
+	}
 	//cmd := ws.NewGetWebhookCmd(registration.WebhookID, mobile_app.NewWebhookGetConfigCmd())
 	// cmd := ws.NewGetConfigCmd()
 	// hass.SendCommandWithCallback(cmd, func(message *ws.IncomingResultMessage) {
@@ -229,8 +237,18 @@ func SetupMobile(creds auth.Credentials, content *ui.MainContent) (*mobile_app.M
 	// hass.SendCommandWithCallback(ws.NewGetConfigCmd(), func(message *ws.IncomingResultMessage) {
 	// 	pp.Println(message)
 	// })
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		logger.I().Warn("Unable to connect to the system bus", "error", err)
+	}
+	sessionConn, err := dbus.SessionBus()
+	if err != nil {
+		logger.I().Warn("Unable to connect to the session bus", "error", err)
+	}
+
+	RegisterCommands(mobile, conn, sessionConn)
 	mobile.EnableWebsocketPushNotifications()
-	go mobile.WatchForPushNotifications(mobile.FreedesktopNotifier)
+	go mobile.WatchForPushNotifications(mobile.HandlePushNotification)
 	go func() {
 		err := mobile.MonitorLocation()
 		if err != nil {
@@ -238,31 +256,44 @@ func SetupMobile(creds auth.Credentials, content *ui.MainContent) (*mobile_app.M
 		}
 	}()
 
-	conn, err := dbus.SystemBus()
-	if err == nil {
-		batteries, err := sensors.DiscoverBatteries(conn)
-		if err == nil {
-			for _, battery := range batteries {
-				mobile.SensorCollector.AddSensor(battery)
-				content.AppendSensor(battery)
-
-			}
+	registry, err := config.LoadSensorRegistry()
+	if err != nil {
+		logger.I().Warn("Unable to load the sensor registry", "error", err)
+	}
+	if newRegistration {
+		// Nothing was registered with an earlier scheme
+		registry = config.SensorRegistry{Version: sensors.IDVersion}
+	}
+	collector := mobile.SensorCollector
+	collector.RegisteredSensors = registry.Registered
+	collector.DisabledSensors = registry.Disabled
+	saveRegistry := func() {
+		registered, disabled := collector.Registry()
+		err := config.SaveSensorRegistry(config.SensorRegistry{
+			Version:    sensors.IDVersion,
+			Registered: registered,
+			Disabled:   disabled,
+		})
+		if err != nil {
+			logger.I().Error("Unable to save the sensor registry", "error", err)
 		}
 	}
+	collector.RegistryChanged = saveRegistry
 
-	memory, err := sensors.DiscoverMemory()
-	if err == nil {
-		mobile.SensorCollector.AddSensor(memory)
-		content.AppendSensor(memory)
-	}
-	load, err := sensors.DiscoverAverageLoad()
-	if err == nil {
-		mobile.SensorCollector.AddSensor(load)
-		content.AppendSensor(load)
+	set := NewSensorSet(collector, content, BuiltinSensors(conn, sessionConn), registry.Version)
+	set.Apply()
+	saveRegistry()
+	config.OnChange(set.Apply)
+
+	discoveryInterval := 5 * time.Minute
+	if config.IsSet("discovery.interval") {
+		discoveryInterval = config.GetDuration("discovery.interval")
 	}
+	stop := make(chan struct{})
+	go set.WatchDevices(conn, discoveryInterval, stop)
 
 	go mobile.SensorCollector.Collect()
-	return mobile, nil
+	return mobile, stop, nil
 }
 
 func SetupStateTracking() *states.Store {
@@ -0,0 +1,632 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/subutux/hass_companion/hass/mobile_app/sensors"
+	"github.com/subutux/hass_companion/internal/config"
+	"github.com/subutux/hass_companion/internal/logger"
+	"github.com/subutux/hass_companion/internal/ui"
+)
+
+// BuiltinSensor is a sensor shipped with the companion, configurable by its
+// name in the sensors section of the config.
+type BuiltinSensor struct {
+	Name string
+	// Namespace prefixes the unique IDs of the sensors, when they don't
+	// start with it already. It defaults to Name.
+	Namespace string
+	Discover  func() ([]sensors.SensorInterface, error)
+	// Hotplug sensors find devices that come and go. They are discovered
+	// again on the discovery interval, and when a device of one of the udev
+	// Subsystems or one of the D-Bus Signals announces a change.
+	Hotplug    bool
+	Subsystems []string
+	Signals    []DeviceSignal
+}
+
+func (b BuiltinSensor) namespace() string {
+	if b.Namespace != "" {
+		return b.Namespace
+	}
+	return b.Name
+}
+
+// commandNamespace prefixes the unique IDs of command sensors.
+const commandNamespace = "command"
+
+// BuiltinSensors returns the built-in sensors in the order they are shown.
+func BuiltinSensors(systemBus, sessionBus *dbus.Conn) []BuiltinSensor {
+	return []BuiltinSensor{
+		{
+			Name:       "battery",
+			Hotplug:    true,
+			Subsystems: []string{"power_supply"},
+			Signals: []DeviceSignal{
+				{Name: "org.freedesktop.UPower.DeviceAdded", Path: "/org/freedesktop/UPower"},
+				{Name: "org.freedesktop.UPower.DeviceRemoved", Path: "/org/freedesktop/UPower"},
+			},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				batteries, err := sensors.DiscoverBatteries(systemBus)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, battery := range batteries {
+					found = append(found, battery)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "power",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				power, err := sensors.DiscoverPower(systemBus)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, p := range power {
+					found = append(found, p)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "backlight",
+			Hotplug:    true,
+			Subsystems: []string{"backlight"},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				backlight, err := sensors.DiscoverBacklight()
+				if err != nil || backlight == nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{backlight}, nil
+			},
+		},
+		{
+			Name: "network",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				network, err := sensors.DiscoverNetwork(systemBus)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, n := range network {
+					found = append(found, n)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "traffic",
+			Namespace:  "network",
+			Hotplug:    true,
+			Subsystems: []string{"net"},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				conf := config.Sensor("traffic")
+				traffic, err := sensors.DiscoverNetworkTraffic(conf.Include, conf.Exclude)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, t := range traffic {
+					found = append(found, t)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "session",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				sessions, err := sensors.DiscoverSession(systemBus)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, s := range sessions {
+					found = append(found, s)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "updates",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				updates, err := sensors.DiscoverUpdates(systemBus)
+				if err != nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{updates}, nil
+			},
+		},
+		{
+			Name:      "containers",
+			Namespace: "container",
+			Hotplug:   true,
+			Discover: func() ([]sensors.SensorInterface, error) {
+				containers, err := sensors.DiscoverContainers(config.Sensor("containers").Include)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, c := range containers {
+					found = append(found, c)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "bluetooth",
+			Hotplug:    true,
+			Subsystems: []string{"bluetooth"},
+			Signals: []DeviceSignal{
+				{Name: "org.freedesktop.DBus.ObjectManager.InterfacesAdded", Path: "/org/bluez"},
+				{Name: "org.freedesktop.DBus.ObjectManager.InterfacesRemoved", Path: "/org/bluez"},
+			},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				bluetooth, err := sensors.DiscoverBluetooth(systemBus, config.Sensor("bluetooth").Include)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, b := range bluetooth {
+					found = append(found, b)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "systemd",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if systemBus == nil {
+					return nil, errors.New("no system bus available")
+				}
+				units, err := sensors.DiscoverUnits(systemBus, false, config.Sensor("systemd").Include)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, u := range units {
+					found = append(found, u)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "systemd_user",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if sessionBus == nil {
+					return nil, errors.New("no session bus available")
+				}
+				units, err := sensors.DiscoverUnits(sessionBus, true, config.Sensor("systemd_user").Include)
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, u := range units {
+					found = append(found, u)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "media",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				if sessionBus == nil {
+					return nil, errors.New("no session bus available")
+				}
+				media, err := sensors.DiscoverMediaPlayer(sessionBus)
+				if err != nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{media}, nil
+			},
+		},
+		{
+			Name: "audio",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				audio, err := sensors.DiscoverAudio()
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, a := range audio {
+					found = append(found, a)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "camera",
+			Hotplug:    true,
+			Subsystems: []string{"video4linux"},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				camera, err := sensors.DiscoverCamera()
+				if err != nil || camera == nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{camera}, nil
+			},
+		},
+		{
+			Name: "window",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				window, err := sensors.DiscoverActiveWindow(sessionBus, config.Sensor("window").IsPrivate())
+				if err != nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{window}, nil
+			},
+		},
+		{
+			Name: "memory",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				memory, err := sensors.DiscoverMemory()
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, m := range memory {
+					found = append(found, m)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "cpu",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				cpus, err := sensors.DiscoverCPU()
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, cpu := range cpus {
+					found = append(found, cpu)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "hwmon",
+			Hotplug:    true,
+			Subsystems: []string{"hwmon"},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				hardware, err := sensors.DiscoverHardware()
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, h := range hardware {
+					found = append(found, h)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name:       "disk",
+			Hotplug:    true,
+			Subsystems: []string{"block"},
+			Discover: func() ([]sensors.SensorInterface, error) {
+				conf := config.Sensor("disk")
+				return sensors.DiscoverDisks(conf.Include, conf.Exclude)
+			},
+		},
+		{
+			Name: "host",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				hosts, err := sensors.DiscoverHost()
+				if err != nil {
+					return nil, err
+				}
+				found := []sensors.SensorInterface{}
+				for _, h := range hosts {
+					found = append(found, h)
+				}
+				return found, nil
+			},
+		},
+		{
+			Name: "load",
+			Discover: func() ([]sensors.SensorInterface, error) {
+				load, err := sensors.DiscoverAverageLoad()
+				if err != nil {
+					return nil, err
+				}
+				return []sensors.SensorInterface{load}, nil
+			},
+		},
+	}
+}
+
+// sensorDefaults holds the settings of a sensor before the config was
+// applied, so they can be restored when an override is removed.
+type sensorDefaults struct {
+	Name      string
+	Icon      string
+	Threshold float64
+}
+
+// sensorPatterns are the include and exclude patterns a built-in sensor was
+// discovered with.
+type sensorPatterns struct {
+	Include []string
+	Exclude []string
+}
+
+func patternsOf(conf config.SensorConfig) sensorPatterns {
+	return sensorPatterns{Include: conf.Include, Exclude: conf.Exclude}
+}
+
+// SensorSet keeps the sensors of the collector and the UI in line with the
+// sensors section of the config.
+type SensorSet struct {
+	mu        sync.Mutex
+	collector *sensors.Collector
+	content   *ui.MainContent
+	builtin   []BuiltinSensor
+	active    map[string][]sensors.SensorInterface
+	defaults  map[string]sensorDefaults
+	intervals map[sensors.SensorInterface]time.Duration
+	patterns  map[string]sensorPatterns
+	commands  map[string]*commandSensor
+	// Version of the unique ID scheme of the registered sensors, and the
+	// other unique IDs each sensor has in the other schemes.
+	idVersion int
+	previous  map[string][]string
+}
+
+// commandSensor is a running command sensor and the config it was created
+// from.
+type commandSensor struct {
+	conf   config.CommandSensorConfig
+	sensor *sensors.Command
+}
+
+// NewSensorSet creates a sensor set for sensors registered with version
+// idVersion of the unique ID scheme.
+func NewSensorSet(collector *sensors.Collector, content *ui.MainContent, builtin []BuiltinSensor, idVersion int) *SensorSet {
+	return &SensorSet{
+		collector: collector,
+		content:   content,
+		builtin:   builtin,
+		active:    map[string][]sensors.SensorInterface{},
+		defaults:  map[string]sensorDefaults{},
+		intervals: map[sensors.SensorInterface]time.Duration{},
+		patterns:  map[string]sensorPatterns{},
+		commands:  map[string]*commandSensor{},
+		idVersion: idVersion,
+		previous:  map[string][]string{},
+	}
+}
+
+// Apply discovers the enabled sensors, removes the disabled ones and applies
+// the configured overrides. It is safe to call again when the config changes.
+func (s *SensorSet) Apply() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, builtin := range s.builtin {
+		conf := config.Sensor(builtin.Name)
+		active, ok := s.active[builtin.Name]
+
+		if !conf.IsEnabled() {
+			if ok {
+				logger.I().Info("Disabling sensor", "sensor", builtin.Name)
+				for _, sensor := range active {
+					s.collector.RemoveSensor(sensor)
+					s.content.RemoveSensor(sensor)
+				}
+				delete(s.active, builtin.Name)
+				delete(s.patterns, builtin.Name)
+			}
+			continue
+		}
+
+		if ok {
+			if !reflect.DeepEqual(patternsOf(conf), s.patterns[builtin.Name]) {
+				logger.I().Info("Discovering sensor again for the changed include or exclude", "sensor", builtin.Name)
+				s.rediscover(builtin)
+			}
+			for _, sensor := range s.active[builtin.Name] {
+				s.configure(builtin.Name, sensor)
+			}
+			continue
+		}
+
+		found, err := builtin.Discover()
+		if err != nil {
+			logger.I().Warn("Failed to discover sensor", "sensor", builtin.Name, "error", err)
+			continue
+		}
+		if len(found) == 0 {
+			logger.I().Info("No sensors discovered", "sensor", builtin.Name)
+			continue
+		}
+		s.active[builtin.Name] = found
+		s.patterns[builtin.Name] = patternsOf(conf)
+		for _, sensor := range found {
+			s.adopt(builtin.namespace(), sensor)
+			s.configure(builtin.Name, sensor)
+			s.collector.AddSensor(sensor)
+			s.content.AppendSensor(sensor)
+		}
+	}
+
+	s.applyCommands()
+	// Sensors found from now on were registered with the current scheme,
+	// if at all.
+	s.idVersion = sensors.IDVersion
+}
+
+// adopt gives the sensors of a newly discovered sensor their unique ID. The
+// sensors the first releases registered keep their unique ID of back then,
+// so their entities in Home Assistant keep working. Other sensors get the
+// unique ID of the current scheme. When the scheme of the registered sensors
+// isn't known, the old IDs of the first releases are assumed registered.
+func (s *SensorSet) adopt(namespace string, sensor sensors.SensorInterface) {
+	registered, _ := s.collector.Registry()
+	for _, sen := range sensor.GetSensors() {
+		id := sen.UniqueID
+		ids := append([]string{sensors.UniqueID(namespace, id)}, sensors.PreviousIDs(namespace, id)...)
+		kept := 0
+		for i, old := range ids[1:] {
+			if sensors.IsLegacyID(namespace, old) && (s.idVersion == 0 || contains(registered, old)) {
+				kept = i + 1
+				break
+			}
+		}
+		uniqueID := ids[kept]
+		s.collector.Reconfigure(func() {
+			sen.UniqueID = uniqueID
+		})
+		others := []string{}
+		for _, other := range ids {
+			if other != uniqueID {
+				others = append(others, other)
+			}
+		}
+		s.previous[uniqueID] = others
+	}
+}
+
+// applyCommands creates, recreates or removes command sensors to match the
+// commands section of the config.
+func (s *SensorSet) applyCommands() {
+	wanted := map[string]bool{}
+	for _, conf := range config.CommandSensors() {
+		id := conf.ID()
+		if conf.Command == "" {
+			logger.I().Warn("Command sensor without command", "sensor", id)
+			continue
+		}
+		wanted[id] = true
+
+		existing, ok := s.commands[id]
+		if ok && reflect.DeepEqual(existing.conf, conf) {
+			continue
+		}
+		if ok {
+			s.removeCommand(id)
+		}
+
+		name := conf.Name
+		if name == "" {
+			name = id
+		}
+		sensor := sensors.NewCommand(sensors.Sensor{
+			Name:              name,
+			UniqueID:          id,
+			Type:              conf.Type,
+			Icon:              conf.Icon,
+			DeviceClass:       conf.DeviceClass,
+			UnitOfMeasurement: conf.UnitOfMeasurement,
+			StateClass:        conf.StateClass,
+			EntityCategory:    conf.EntityCategory,
+		}, conf.Command, conf.Interval, conf.Timeout)
+		s.adopt(commandNamespace, sensor)
+		s.commands[id] = &commandSensor{conf: conf, sensor: sensor}
+		if ok {
+			// Registering again updates the entity in Home Assistant
+			s.collector.MarkUnregistered(sensor.UniqueID)
+		}
+		s.collector.AddSensor(sensor)
+		s.content.AppendSensor(sensor)
+	}
+
+	for id := range s.commands {
+		if !wanted[id] {
+			s.removeCommand(id)
+		}
+	}
+}
+
+func (s *SensorSet) removeCommand(id string) {
+	command := s.commands[id]
+	s.collector.RemoveSensor(command.sensor)
+	s.content.RemoveSensor(command.sensor)
+	delete(s.commands, id)
+}
+
+// configure applies the config of the built-in sensor name, and the
+// overrides for each unique ID, to the sensor.
+func (s *SensorSet) configure(name string, sensor sensors.SensorInterface) {
+	if poller, ok := sensor.(sensors.SensorPoller); ok {
+		def, ok := s.intervals[sensor]
+		if !ok {
+			def = poller.Interval()
+			s.intervals[sensor] = def
+		}
+		interval := config.Sensor(name).Interval
+		if interval == 0 {
+			interval = def
+		}
+		if interval != poller.Interval() {
+			poller.SetInterval(interval)
+			s.collector.Reschedule(sensor)
+		}
+	}
+
+	if privacy, ok := sensor.(sensors.SensorPrivacy); ok {
+		privacy.SetPrivate(config.Sensor(name).IsPrivate())
+	}
+
+	for _, sen := range sensor.GetSensors() {
+		def, ok := s.defaults[sen.UniqueID]
+		if !ok {
+			def = sensorDefaults{
+				Name:      sen.Name,
+				Icon:      sen.Icon,
+				Threshold: sen.Threshold,
+			}
+			s.defaults[sen.UniqueID] = def
+		}
+
+		// Overrides by the unique IDs of the other schemes apply as well
+		names := append([]string{name}, s.previous[sen.UniqueID]...)
+		conf := config.Sensor(append(names, sen.UniqueID)...)
+		wanted := def
+		if conf.Name != "" {
+			wanted.Name = conf.Name
+		}
+		if conf.Icon != "" {
+			wanted.Icon = conf.Icon
+		}
+		if conf.Threshold != 0 {
+			wanted.Threshold = conf.Threshold
+		}
+
+		s.collector.Reconfigure(func() {
+			sen.Threshold = wanted.Threshold
+			if sen.Name != wanted.Name || sen.Icon != wanted.Icon {
+				sen.Name = wanted.Name
+				sen.Icon = wanted.Icon
+				// Registering again updates the entity in Home Assistant
+				s.collector.MarkUnregistered(sen.UniqueID)
+			}
+		})
+	}
+}